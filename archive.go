@@ -0,0 +1,140 @@
+package zipstream
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// A Directory is the central directory of an archive of the stream, read
+// once all of its entries have been.
+type Directory struct {
+	// Archive is the index of the archive in the stream, counting from 0.
+	Archive int
+
+	// Offset is the position in the stream of the central directory, and
+	// ArchiveOffset the position its offsets are relative to, which is
+	// not the start of the stream for archives that follow other data.
+	Offset        int64
+	ArchiveOffset int64
+
+	// Files are the headers of the central directory, in its order.
+	Files []*zip.FileHeader
+
+	// Missing are the headers of Files for which no local file header was
+	// read at the offset given by the directory.
+	Missing []*zip.FileHeader
+
+	Comment string
+
+	// offsets are the positions in the stream of the local file headers
+	// of Files, or -1 where it could not be located.
+	offsets []int64
+}
+
+// Directory returns the central directory of the last archive whose end
+// has been reached, or nil if there is none yet. It changes when Next
+// returns io.EOF or, with SetConcatenated, when Next returns the first
+// entry of the following archive.
+func (r *Reader) Directory() *Directory {
+	return r.directory
+}
+
+// SetConcatenated sets whether Next treats archives that follow each other
+// in the stream as one. If so, Next moves on to the next archive at the
+// end of each one and only returns io.EOF at the end of the stream; the
+// archive of each entry is told by Entry.Archive.
+func (r *Reader) SetConcatenated(concatenated bool) {
+	r.concatenated = concatenated
+}
+
+// NextArchive discards the rest of the current archive, so that the next
+// call to Next returns the first entry of the archive that follows. Once
+// Next has returned io.EOF, the current archive is the one that follows,
+// so NextArchive only checks that there is one. It returns io.EOF if the
+// stream ends after the current archive.
+func (r *Reader) NextArchive() error {
+	concatenated := r.concatenated
+	r.concatenated = false
+	defer func() { r.concatenated = concatenated }()
+
+	for !r.ended {
+		if _, err := r.Next(); err != nil {
+			if err == io.EOF && r.ended {
+				break
+			}
+			return err
+		}
+		if err := r.skipEntry(); err != nil {
+			return err
+		}
+	}
+	r.ended = false
+	_, err := r.br.Peek(1)
+	return err
+}
+
+// readCentralDirectory reads the central directory of the current archive,
+// and fills in the attributes only stored there in the headers returned
+// for its entries. It returns io.EOF once it is read.
+func (r *Reader) readCentralDirectory() error {
+	start := r.offset()
+	d, err := readCentralDirectory(r.br)
+	if err != io.EOF {
+		return err
+	}
+
+	// Offsets in the directory are relative to the start of the archive,
+	// which need not be the start of the stream, or with volumes to the
+	// start of the volume they are in.
+	base := start - d.dirOffset
+	locate := func(disk uint32, offset int64) (int64, error) {
+		return base + offset, nil
+	}
+	var mismatch error
+	if v := r.volumes; v != nil {
+		base = 0
+		locate = v.offset
+		if dirStart, err := v.offset(d.dirDisk, d.dirOffset); err != nil || dirStart != start ||
+			int(d.diskNumber) != v.volume(r.offset()-1) {
+			mismatch = ErrVolume
+		}
+		// Read the last volume to its end, so that it is closed.
+		r.br.Peek(1)
+	}
+
+	dir := &Directory{
+		Archive:       r.archive,
+		Offset:        start,
+		ArchiveOffset: base,
+		Files:         make([]*zip.FileHeader, len(d.records)),
+		Comment:       d.comment,
+		offsets:       make([]int64, len(d.records)),
+	}
+	for i, rec := range d.records {
+		dir.Files[i] = &rec.FileHeader
+		offset, err := locate(rec.diskNumber, rec.headerOffset)
+		if dir.offsets[i] = offset; err != nil {
+			dir.offsets[i] = -1
+		}
+		f := r.local[offset]
+		if err != nil || f == nil {
+			dir.Missing = append(dir.Missing, &rec.FileHeader)
+			if r.volumes != nil {
+				mismatch = ErrVolume
+			}
+			continue
+		}
+		f.CreatorVersion = rec.CreatorVersion
+		f.ExternalAttrs = rec.ExternalAttrs
+		f.Comment = rec.Comment
+	}
+	r.local = nil
+	r.directory = dir
+	r.archive++
+	r.ended = true
+	if mismatch != nil {
+		return mismatch
+	}
+	return io.EOF
+}
@@ -0,0 +1,113 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func concatenatedZips(t *testing.T) []byte {
+	var buf bytes.Buffer
+	buf.Write(walkZip(t, "a", "b"))
+	buf.Write(walkZip(t, "c"))
+	buf.Write(walkZip(t, "d", "e", "f"))
+	return buf.Bytes()
+}
+
+func TestArchives(t *testing.T) {
+	z := concatenatedZips(t)
+	want := [][]string{{"a", "b"}, {"c"}, {"d", "e", "f"}}
+
+	r := NewReader(bytes.NewReader(z))
+	for i, names := range want {
+		var first int64
+		for j, name := range names {
+			h, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j == 0 {
+				first = r.Entry().HeaderOffset
+			}
+			if h.Name != name || r.Entry().Archive != i {
+				t.Errorf("entry %q of archive %d, want %q of archive %d", h.Name, r.Entry().Archive, name, i)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("archive %d: Next = %v, want io.EOF", i, err)
+		}
+		d := r.Directory()
+		if d == nil || d.Archive != i || len(d.Files) != len(names) || len(d.Missing) != 0 {
+			t.Fatalf("archive %d: unexpected directory %+v", i, d)
+		}
+		if d.ArchiveOffset != first || d.Offset <= first {
+			t.Errorf("archive %d: offsets %d, %d, first header at %d", i, d.ArchiveOffset, d.Offset, first)
+		}
+		for j, f := range d.Files {
+			if f.Name != names[j] {
+				t.Errorf("archive %d: directory file %d is %q, want %q", i, j, f.Name, names[j])
+			}
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Next at the end of the stream = %v, want io.EOF", err)
+	}
+}
+
+func TestNextArchive(t *testing.T) {
+	r := NewReader(bytes.NewReader(concatenatedZips(t)))
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	// Skip b and the central directory of the first archive.
+	if err := r.NextArchive(); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := r.Next(); err != nil || h.Name != "c" {
+		t.Fatalf("Next = %v, %v, want c", h, err)
+	}
+	if d := r.Directory(); d == nil || d.Archive != 0 {
+		t.Fatalf("directory %+v, want that of archive 0", d)
+	}
+
+	// Skip the rest of the second archive and all of the third.
+	if err := r.NextArchive(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.NextArchive(); err != io.EOF {
+		t.Fatalf("NextArchive at the last archive = %v, want io.EOF", err)
+	}
+	if d := r.Directory(); d == nil || d.Archive != 2 {
+		t.Fatalf("directory %+v, want that of archive 2", d)
+	}
+}
+
+func TestConcatenated(t *testing.T) {
+	z := concatenatedZips(t)
+	for _, workers := range []int{0, 2} {
+		r := NewReader(bytes.NewReader(z))
+		r.SetConcurrency(workers, 1<<20)
+		r.SetConcatenated(true)
+		var names string
+		for {
+			h, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := r.Entry()
+			names += h.Name
+			if e.Archive > 0 && (r.Directory() == nil || r.Directory().Archive != e.Archive-1) {
+				t.Errorf("workers %d, %s: directory %+v, want that of archive %d", workers, h.Name, r.Directory(), e.Archive-1)
+			}
+		}
+		if names != "abcdef" {
+			t.Errorf("workers %d: read %q, want %q", workers, names, "abcdef")
+		}
+		if d := r.Directory(); d == nil || d.Archive != 2 {
+			t.Errorf("workers %d: final directory %+v, want that of archive 2", workers, d)
+		}
+	}
+}
@@ -9,75 +9,208 @@ import (
 	"github.com/klauspost/compress/zip"
 )
 
-// We're not interested in the central directories data, we just want to skip over it,
-// clearing the stream of the current zip, in case anything needs to be sent over the
-// same stream.
-func discardCentralDirectory(br *bufio.Reader) error {
+const (
+	directoryHeaderLen = 46 // + filename + extra + comment
+	directoryEndLen    = 22 // + comment
+)
+
+// directoryRecord is a central directory file header along with the
+// location of the local file header it describes.
+type directoryRecord struct {
+	zip.FileHeader
+	diskNumber   uint32
+	headerOffset int64 // relative to the start of the archive
+}
+
+// centralDirectory holds what was read from the central directory and
+// end of central directory records of an archive.
+type centralDirectory struct {
+	records    []*directoryRecord
+	diskNumber uint32 // of the disk with the end record
+	dirDisk    uint32 // of the disk with the start of the directory
+	dirOffset  int64  // offset of the directory relative to the start of dirDisk
+	comment    string
+}
+
+// readCentralDirectory reads the central directory that follows the last
+// entry of an archive, clearing the stream of the current zip, in case
+// anything needs to be sent over the same stream.
+func readCentralDirectory(br *bufio.Reader) (*centralDirectory, error) {
+	d := new(centralDirectory)
 	for {
 		sigBytes, err := br.Peek(4)
 		if err != nil {
-			return err
+			return d, err
 		}
 		switch sig := binary.LittleEndian.Uint32(sigBytes); sig {
 		case directoryHeaderSignature:
-			if err := discardDirectoryHeaderRecord(br); err != nil {
-				return err
+			rec, err := readDirectoryHeader(br)
+			if err != nil {
+				return d, err
 			}
+			d.records = append(d.records, rec)
 		case directoryEndSignature:
-			if err := discardDirectoryEndRecord(br); err != nil {
-				return err
+			if err := d.readEndRecord(br); err != nil {
+				return d, err
 			}
-			return io.EOF
+			return d, io.EOF
 		case directory64EndSignature:
-			if err := discardDirectory64End(br); err != nil {
-				return err
+			if err := d.readDirectory64End(br); err != nil {
+				return d, err
 			}
 		case directory64LocSignature:
 			if err := discardDirectory64EndLocator(br); err != nil {
-				return err
+				return d, err
 			}
 		default:
-			return zip.ErrFormat
+			return d, zip.ErrFormat
 		}
 	}
 }
 
-func discardDirectoryHeaderRecord(br *bufio.Reader) error {
-	if _, err := br.Discard(28); err != nil {
-		return err
+func readDirectoryHeader(r io.Reader) (*directoryRecord, error) {
+	var buf [directoryHeaderLen]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
 	}
-	lb, err := br.Peek(6)
-	if err != nil {
-		return err
+	b := readBuf(buf[4:])
+	f := new(directoryRecord)
+	f.CreatorVersion = b.uint16()
+	f.ReaderVersion = b.uint16()
+	f.Flags = b.uint16()
+	f.Method = b.uint16()
+	f.ModifiedTime = b.uint16()
+	f.ModifiedDate = b.uint16()
+	f.CRC32 = b.uint32()
+	f.CompressedSize = b.uint32()
+	f.UncompressedSize = b.uint32()
+	f.CompressedSize64 = uint64(f.CompressedSize)
+	f.UncompressedSize64 = uint64(f.UncompressedSize)
+	filenameLen := int(b.uint16())
+	extraLen := int(b.uint16())
+	commentLen := int(b.uint16())
+	f.diskNumber = uint32(b.uint16())
+	b.uint16() // internal attributes (ignored)
+	f.ExternalAttrs = b.uint32()
+	f.headerOffset = int64(b.uint32())
+	d := make([]byte, filenameLen+extraLen+commentLen)
+	if _, err := io.ReadFull(r, d); err != nil {
+		return nil, err
 	}
-	lengths := int(binary.LittleEndian.Uint16(lb[:2])) + // File name length
-		int(binary.LittleEndian.Uint16(lb[2:4])) + // Extra field length
-		int(binary.LittleEndian.Uint16(lb[4:])) // File comment length
-	_, err = br.Discard(18 + lengths)
-	return err
+	f.Name = string(d[:filenameLen])
+	f.Extra = d[filenameLen : filenameLen+extraLen]
+	f.Comment = string(d[filenameLen+extraLen:])
+
+	extras := ParseExtras(f.Extra)
+	if name, ok := unicodeValue(extras.UnicodePath, d[:filenameLen]); ok {
+		f.Name = name
+	}
+	if comment, ok := unicodeValue(extras.UnicodeComment, d[filenameLen+extraLen:]); ok {
+		f.Comment = comment
+	}
+
+	needUSize := f.UncompressedSize == ^uint32(0)
+	needCSize := f.CompressedSize == ^uint32(0)
+	needHeaderOffset := f.headerOffset == int64(^uint32(0))
+	needDiskNumber := f.diskNumber == uint32(^uint16(0))
+
+	for extra := readBuf(f.Extra); len(extra) >= 4; { // need at least tag and size
+		fieldTag := extra.uint16()
+		fieldSize := int(extra.uint16())
+		if len(extra) < fieldSize {
+			break
+		}
+		fieldBuf := extra.sub(fieldSize)
+		if fieldTag != zip64ExtraID {
+			continue
+		}
+
+		// The zip64 extra block only holds the values that are
+		// maxed out in the fixed part of the record, in this order.
+		if needUSize {
+			needUSize = false
+			if len(fieldBuf) < 8 {
+				return nil, zip.ErrFormat
+			}
+			f.UncompressedSize64 = fieldBuf.uint64()
+		}
+		if needCSize {
+			needCSize = false
+			if len(fieldBuf) < 8 {
+				return nil, zip.ErrFormat
+			}
+			f.CompressedSize64 = fieldBuf.uint64()
+		}
+		if needHeaderOffset {
+			needHeaderOffset = false
+			if len(fieldBuf) < 8 {
+				return nil, zip.ErrFormat
+			}
+			f.headerOffset = int64(fieldBuf.uint64())
+		}
+		if needDiskNumber {
+			needDiskNumber = false
+			if len(fieldBuf) < 4 {
+				return nil, zip.ErrFormat
+			}
+			f.diskNumber = fieldBuf.uint32()
+		}
+	}
+
+	if needCSize || needHeaderOffset {
+		return nil, zip.ErrFormat
+	}
+	return f, nil
 }
 
-func discardDirectoryEndRecord(br *bufio.Reader) error {
-	if _, err := br.Discard(20); err != nil {
+func (d *centralDirectory) readEndRecord(br *bufio.Reader) error {
+	var buf [directoryEndLen]byte
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
 		return err
 	}
-	commentLength, err := br.Peek(2)
-	if err != nil {
+	b := readBuf(buf[4:])
+	diskNumber := b.uint16()
+	dirDisk := b.uint16()
+	b.uint16() // number of records on this disk (ignored)
+	b.uint16() // total number of records (ignored)
+	b.uint32() // size of the directory (ignored)
+	dirOffset := b.uint32()
+	comment := make([]byte, int(b.uint16()))
+	if _, err := io.ReadFull(br, comment); err != nil {
 		return err
 	}
-	_, err = br.Discard(2 + int(binary.LittleEndian.Uint16(commentLength)))
-	return err
+	d.comment = string(comment)
+
+	// Values saturated in the end record are taken from the zip64 end
+	// record, which precedes it.
+	if diskNumber != ^uint16(0) {
+		d.diskNumber = uint32(diskNumber)
+	}
+	if dirDisk != ^uint16(0) {
+		d.dirDisk = uint32(dirDisk)
+	}
+	if dirOffset != ^uint32(0) {
+		d.dirOffset = int64(dirOffset)
+	}
+	return nil
 }
 
-func discardDirectory64End(br *bufio.Reader) error {
-	lb, err := br.Peek(12)
+func (d *centralDirectory) readDirectory64End(br *bufio.Reader) error {
+	lb, err := br.Peek(56)
 	if err != nil {
 		return err
 	}
 	totalSize := 12 + binary.LittleEndian.Uint64(lb[4:])
 	if totalSize > 0x7FFFFFFF {
-		return errors.New("discardDirectory64End: size overflow")
+		return errors.New("readDirectory64End: size overflow")
 	}
+	b := readBuf(lb[16:])
+	d.diskNumber = b.uint32()
+	d.dirDisk = b.uint32()
+	b.uint64() // number of records on this disk (ignored)
+	b.uint64() // total number of records (ignored)
+	b.uint64() // size of the directory (ignored)
+	d.dirOffset = int64(b.uint64())
 	_, err = br.Discard(int(totalSize))
 	return err
 }
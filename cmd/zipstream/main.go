@@ -0,0 +1,199 @@
+// Command zipstream reads zip archives as a stream, from a file or the
+// standard input, so that it can be used in pipelines:
+//
+//	curl -s https://example.com/archive.zip | zipstream ls
+//
+// Usage:
+//
+//	zipstream ls [-json] [FILE]   list the entries, as JSON lines with -json
+//	zipstream cat NAME [FILE]     write the content of an entry
+//	zipstream extract DIR [FILE]  extract the entries to a directory
+//	zipstream test [FILE]         verify the CRC-32 and size of the entries
+//
+// The archive is read from the standard input if FILE is omitted or "-".
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zip"
+	"github.com/xenking/zipstream"
+)
+
+const usage = `usage:
+	zipstream ls [-json] [FILE]
+	zipstream cat NAME [FILE]
+	zipstream extract DIR [FILE]
+	zipstream test [FILE]
+`
+
+// errUsage is returned for invalid arguments.
+var errUsage = errors.New(usage)
+
+// errFailed is returned by test when entries failed, which it reported.
+var errFailed = errors.New("some entries failed")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err == errUsage {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "zipstream:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command of args, reading the archive from stdin if no file
+// is given.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	var arg string
+	switch cmd {
+	case "cat", "extract":
+		if len(args) == 0 {
+			return errUsage
+		}
+		arg, args = args[0], args[1:]
+	case "ls":
+		if len(args) > 0 && args[0] == "-json" {
+			arg, args = args[0], args[1:]
+		}
+	case "test":
+	default:
+		return errUsage
+	}
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	in := stdin
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r := zipstream.NewReader(in)
+
+	switch cmd {
+	case "ls":
+		if arg == "-json" {
+			return zipstream.WriteListing(stdout, r)
+		}
+		return list(r, stdout)
+	case "cat":
+		return cat(r, arg, stdout)
+	case "extract":
+		x := &zipstream.Extractor{Dir: arg, Symlinks: zipstream.SymlinkCreate}
+		return x.Extract(r)
+	default:
+		return test(r, stdout)
+	}
+}
+
+var methods = map[uint16]string{
+	zipstream.Store:   "store",
+	zipstream.Deflate: "deflate",
+	9:                 "deflate64",
+	12:                "bzip2",
+	14:                "lzma",
+	93:                "zstd",
+	95:                "xz",
+	98:                "ppmd",
+	99:                "aes",
+}
+
+func methodName(method uint16) string {
+	if name, ok := methods[method]; ok {
+		return name
+	}
+	return fmt.Sprintf("method%d", method)
+}
+
+// list writes a line for every entry, once its content is skipped so that
+// sizes from data descriptors are known. Entries compressed with methods
+// that cannot be decompressed are listed all the same.
+func list(r *zipstream.Reader, w io.Writer) error {
+	fmt.Fprintf(w, "%10s  %-9s %10s %10s  %-19s  %s\n", "OFFSET", "METHOD", "SIZE", "COMPRESSED", "MODIFIED", "NAME")
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != zip.ErrAlgorithm {
+			return err
+		}
+		e := r.Entry()
+		if err := r.Skip(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%10d  %-9s %10d %10d  %s  %s\n", e.HeaderOffset, methodName(e.Method),
+			e.UncompressedSize64, e.CompressedSize64, e.Modified.Format("2006-01-02 15:04:05"), e.Name)
+	}
+}
+
+// cat copies the content of the entry named name, and stops reading there.
+func cat(r *zipstream.Reader, name string, w io.Writer) error {
+	found := false
+	err := r.Walk(func(e *zipstream.Entry, content io.Reader) error {
+		if e.Name != name {
+			return zipstream.SkipEntry
+		}
+		found = true
+		if _, err := io.Copy(w, content); err != nil {
+			return err
+		}
+		return zipstream.StopWalk
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("%s: no such entry", name)
+	}
+	return err
+}
+
+// test reads every entry, reporting those whose content does not match
+// their CRC-32 or size, or cannot be decompressed. Entries that fail do not
+// stop it, unless the stream cannot be read past them.
+func test(r *zipstream.Reader, w io.Writer) error {
+	failed := false
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != zip.ErrAlgorithm {
+			return err
+		}
+		e := r.Entry()
+		if err == nil {
+			var n int64
+			n, err = io.Copy(ioutil.Discard, r)
+			if err == nil && uint64(n) != e.UncompressedSize64 {
+				err = fmt.Errorf("size %d, want %d", n, e.UncompressedSize64)
+			}
+		}
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "FAIL  %s: %v\n", e.Name, err)
+		} else {
+			fmt.Fprintf(w, "OK    %s\n", e.Name)
+		}
+		if err := r.Skip(); err != nil {
+			return err
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func TestRun(t *testing.T) {
+	z, err := ioutil.ReadFile("../../testdata/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(args, bytes.NewReader(z), &out)
+		return out.String(), err
+	}
+
+	out, err := cmd("ls")
+	if err != nil || !strings.Contains(out, "test.txt") || !strings.Contains(out, "gophercolor16x16.png") {
+		t.Errorf("ls: %v\n%s", err, out)
+	}
+	if out, err = cmd("ls", "-json"); err != nil || strings.Count(out, "\n") != 3 || !strings.Contains(out, `"name":"test.txt"`) {
+		t.Errorf("ls -json: %v\n%s", err, out)
+	}
+	if out, err = cmd("cat", "test.txt"); err != nil || !strings.HasPrefix(out, "This is a test text file.") {
+		t.Errorf("cat: %v %q", err, out)
+	}
+	if _, err = cmd("cat", "missing"); err == nil {
+		t.Error("cat of a missing entry succeeded")
+	}
+	if out, err = cmd("test", "../../testdata/test.zip"); err != nil || strings.Count(out, "OK") != 2 {
+		t.Errorf("test: %v\n%s", err, out)
+	}
+
+	dir, err := ioutil.TempDir("", "zipstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := cmd("extract", dir, "-"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gophercolor16x16.png")); err != nil {
+		t.Error(err)
+	}
+
+	// A corrupted entry fails the test.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "test.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("This is a test"))
+	zw.Close()
+	z = buf.Bytes()
+	z[bytes.Index(z, []byte("This is a test"))] ^= 1
+	if out, err = cmd("test"); err != errFailed || !strings.Contains(out, "FAIL  test.txt") {
+		t.Errorf("test of a corrupted archive: %v\n%s", err, out)
+	}
+
+	// An entry compressed with an unsupported method is listed, and fails
+	// the test without stopping it.
+	buf.Reset()
+	zw = zip.NewWriter(&buf)
+	if w, err = zw.CreateRaw(&zip.FileHeader{Name: "packed.bz2", Method: 12, CompressedSize64: 5, UncompressedSize64: 10}); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("BZh91"))
+	if w, err = zw.CreateHeader(&zip.FileHeader{Name: "after.txt", Method: zip.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after"))
+	zw.Close()
+	z = buf.Bytes()
+	if out, err = cmd("ls"); err != nil || !strings.Contains(out, "bzip2") || !strings.Contains(out, "after.txt") {
+		t.Errorf("ls of an unsupported method: %v\n%s", err, out)
+	}
+	if out, err = cmd("test"); err != errFailed || !strings.Contains(out, "FAIL  packed.bz2") || !strings.Contains(out, "OK    after.txt") {
+		t.Errorf("test of an unsupported method: %v\n%s", err, out)
+	}
+
+	if _, err = cmd("cat"); err != errUsage {
+		t.Errorf("cat without a name: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package zipstream
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// A ContainerType is a kind of document stored as a zip archive.
+type ContainerType string
+
+const (
+	PlainZip ContainerType = "zip"   // none of the others
+	OOXML    ContainerType = "ooxml" // Office Open XML: DOCX, XLSX, PPTX...
+	ODF      ContainerType = "odf"   // OpenDocument: ODT, ODS, ODP...
+	EPUB     ContainerType = "epub"
+)
+
+const (
+	// maxDetectEntries is the number of entries DetectContainer reads
+	// before it gives up looking for a mimetype or content types entry.
+	maxDetectEntries = 32
+
+	// maxMimetypeSize and maxContentTypesSize bound what is read into
+	// memory of the mimetype and [Content_Types].xml entries.
+	maxMimetypeSize     = 256
+	maxContentTypesSize = 1 << 20
+
+	mimetypeName     = "mimetype"
+	contentTypesName = "[Content_Types].xml"
+)
+
+// ContentTypes map the parts of an OOXML package to their media types, as
+// its [Content_Types].xml entry does.
+type ContentTypes struct {
+	// Defaults are the media types by extension, and Overrides by part
+	// name, such as "/word/document.xml". Both keys are in lower case, as
+	// they compare case-insensitively.
+	Defaults  map[string]string
+	Overrides map[string]string
+}
+
+// Type returns the media type of the part of the given name, with or without
+// its leading slash, or "" if it has none.
+func (ct *ContentTypes) Type(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	if t, ok := ct.Overrides[name]; ok {
+		return t
+	}
+	return ct.Defaults[strings.TrimPrefix(path.Ext(name), ".")]
+}
+
+// A Container is what DetectContainer found of the kind of an archive.
+type Container struct {
+	Type ContainerType
+
+	// MediaType is the content of the mimetype entry of EPUB and ODF
+	// documents, such as "application/vnd.oasis.opendocument.text". For
+	// OOXML documents, it is the content type of the main part without its
+	// ".main+xml" suffix, such as
+	// "application/vnd.openxmlformats-officedocument.wordprocessingml.document".
+	MediaType string
+
+	// ContentTypes are the content types of OOXML documents.
+	ContentTypes *ContentTypes
+
+	// Problems describe how the mimetype entry breaks the rules of EPUB
+	// and ODF, which readers relying on its position at the start of the
+	// file to tell the format trip on. It must be the first entry, stored,
+	// unencrypted, and without extra field.
+	Problems []string
+}
+
+// DetectContainer reads the first entries of the archive of r with Next
+// to tell which kind of document it is from its content rather than its
+// name: a mimetype entry tells EPUB and ODF documents, and a
+// [Content_Types].xml entry OOXML documents. Other archives are PlainZip.
+//
+// Entries are read until one of these is found, or up to a few dozen. r is
+// left after the last of them, so that Next continues with the following
+// entry. zip.ErrFormat is returned if r has no entry.
+//
+// Some writers, such as LibreOffice, put [Content_Types].xml last, which
+// in a large OOXML package is past the entries read from a stream: such a
+// document is reported as PlainZip. A Reader from NewSeekableReader does
+// not have this false negative, as its central directory tells which
+// entries there are from the start and the entries before the one looked
+// for are skipped without being read.
+func DetectContainer(r *Reader) (*Container, error) {
+	limit := maxDetectEntries
+	if d := r.directory; r.seekable != nil {
+		if len(d.Files) == 0 {
+			return nil, zip.ErrFormat
+		}
+		limit = 0
+		for i, f := range d.Files {
+			if f.Name == mimetypeName || f.Name == contentTypesName {
+				limit = i + 1
+				break
+			}
+		}
+	}
+	for i := 0; i < limit; i++ {
+		_, err := r.Next()
+		if err == io.EOF {
+			if i == 0 {
+				return nil, zip.ErrFormat
+			}
+			break
+		}
+		e := r.entry
+		if err == nil {
+			switch e.Name {
+			case mimetypeName:
+				return detectMimetype(r, e, i)
+			case contentTypesName:
+				return detectContentTypes(r)
+			}
+			err = r.skipEntry()
+		} else if err == zip.ErrAlgorithm {
+			err = r.skipUnsupported()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Container{Type: PlainZip}, nil
+}
+
+// detectMimetype classifies an archive by the content of its mimetype
+// entry e, the ith of the archive.
+func detectMimetype(r *Reader, e *Entry, i int) (*Container, error) {
+	b, err := readSmall(r, maxMimetypeSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &Container{Type: PlainZip, MediaType: string(b)}
+	switch mediaType := strings.TrimSpace(c.MediaType); {
+	case mediaType == "application/epub+zip":
+		c.Type = EPUB
+	case strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument."):
+		c.Type = ODF
+	default:
+		return c, nil
+	}
+
+	if i > 0 || e.HeaderOffset != 0 {
+		c.Problems = append(c.Problems, "mimetype is not at the start of the file")
+	}
+	if e.Method != zip.Store {
+		c.Problems = append(c.Problems, "mimetype is compressed")
+	}
+	if e.Flags&0x1 != 0 {
+		c.Problems = append(c.Problems, "mimetype is encrypted")
+	}
+	if len(e.Extra) > 0 {
+		c.Problems = append(c.Problems, "mimetype has an extra field")
+	}
+	if strings.TrimSpace(c.MediaType) != c.MediaType {
+		c.Problems = append(c.Problems, "mimetype has white space")
+	}
+	return c, nil
+}
+
+// detectContentTypes parses the [Content_Types].xml entry of an OOXML
+// document.
+func detectContentTypes(r *Reader) (*Container, error) {
+	b, err := readSmall(r, maxContentTypesSize)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Defaults []struct {
+			Extension   string `xml:",attr"`
+			ContentType string `xml:",attr"`
+		} `xml:"Default"`
+		Overrides []struct {
+			PartName    string `xml:",attr"`
+			ContentType string `xml:",attr"`
+		} `xml:"Override"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	ct := &ContentTypes{Defaults: make(map[string]string), Overrides: make(map[string]string)}
+	c := &Container{Type: OOXML, ContentTypes: ct}
+	for _, d := range doc.Defaults {
+		ct.Defaults[strings.ToLower(d.Extension)] = d.ContentType
+	}
+	for _, o := range doc.Overrides {
+		ct.Overrides[strings.ToLower(o.PartName)] = o.ContentType
+		if c.MediaType == "" && strings.HasSuffix(o.ContentType, ".main+xml") {
+			c.MediaType = strings.TrimSuffix(o.ContentType, ".main+xml")
+		}
+	}
+	return c, nil
+}
+
+// readSmall reads the content of the current entry of r, returning ErrLimit
+// if it is larger than max.
+func readSmall(r *Reader, max int64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, ErrLimit
+	}
+	return b, nil
+}
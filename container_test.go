@@ -0,0 +1,123 @@
+package zipstream
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="XML" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`
+
+func TestDetectContainer(t *testing.T) {
+	mimetype := func(method uint16, mediaType string) testEntry {
+		return testEntry{h: zip.FileHeader{Name: "mimetype", Method: method}, content: mediaType}
+	}
+	content := deflated("content.xml", "<office/>")
+
+	for _, test := range []struct {
+		name     string
+		files    []testEntry
+		want     Container
+		problems int
+	}{
+		{"epub", []testEntry{mimetype(zip.Store, "application/epub+zip"), content},
+			Container{Type: EPUB, MediaType: "application/epub+zip"}, 0},
+		{"odt", []testEntry{mimetype(zip.Store, "application/vnd.oasis.opendocument.text"), content},
+			Container{Type: ODF, MediaType: "application/vnd.oasis.opendocument.text"}, 0},
+		{"compressed", []testEntry{mimetype(zip.Deflate, "application/epub+zip"), content},
+			Container{Type: EPUB, MediaType: "application/epub+zip"}, 1},
+		{"second", []testEntry{content, mimetype(zip.Deflate, "application/epub+zip\n")},
+			Container{Type: EPUB, MediaType: "application/epub+zip\n"}, 3},
+		{"other", []testEntry{mimetype(zip.Store, "application/x-other")},
+			Container{Type: PlainZip, MediaType: "application/x-other"}, 0},
+		{"plain", []testEntry{content},
+			Container{Type: PlainZip}, 0},
+	} {
+		r := NewReader(bytes.NewReader(testZip(t, "", test.files...)))
+		c, err := DetectContainer(r)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(c.Problems) != test.problems {
+			t.Errorf("%s: problems %q", test.name, c.Problems)
+		}
+		c.Problems = nil
+		if !reflect.DeepEqual(*c, test.want) {
+			t.Errorf("%s: %+v, want %+v", test.name, *c, test.want)
+		}
+	}
+
+	if _, err := DetectContainer(NewReader(bytes.NewReader([]byte("not a zip")))); err != zip.ErrFormat {
+		t.Errorf("not a zip: %v, want %v", err, zip.ErrFormat)
+	}
+}
+
+func TestDetectContainerOOXML(t *testing.T) {
+	z := testZip(t, "",
+		deflated("[Content_Types].xml", contentTypesXML),
+		deflated("word/document.xml", "<w:document/>"),
+	)
+	r := NewReader(bytes.NewReader(z))
+	c, err := DetectContainer(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Type != OOXML || c.MediaType != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" {
+		t.Errorf("%+v", c)
+	}
+	for name, want := range map[string]string{
+		"word/document.xml":  "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+		"/Word/Document.xml": "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+		"/_rels/.rels":       "application/vnd.openxmlformats-package.relationships+xml",
+		"docProps/app.xml":   "application/xml",
+		"media/image.png":    "",
+	} {
+		if got := c.ContentTypes.Type(name); got != want {
+			t.Errorf("type of %s: %q, want %q", name, got, want)
+		}
+	}
+
+	// Reading continues with the entry after [Content_Types].xml.
+	if f, err := r.Next(); err != nil || f.Name != "word/document.xml" {
+		t.Errorf("next: %v %v", f, err)
+	}
+}
+
+func TestDetectContainerLast(t *testing.T) {
+	var entries []testEntry
+	for i := 0; i < 2*maxDetectEntries; i++ {
+		entries = append(entries, deflated(fmt.Sprintf("xl/worksheets/sheet%d.xml", i), "<worksheet/>"))
+	}
+	z := testZip(t, "", append(entries, deflated("[Content_Types].xml", contentTypesXML))...)
+
+	// Too far for a stream
+	c, err := DetectContainer(NewReader(bytes.NewReader(z)))
+	if err != nil || c.Type != PlainZip {
+		t.Errorf("stream: %+v, %v", c, err)
+	}
+
+	r, err := NewSeekableReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = DetectContainer(r); err != nil || c.Type != OOXML {
+		t.Errorf("seekable: %+v, %v", c, err)
+	}
+
+	plain := testZip(t, "", entries...)
+	if r, err = NewSeekableReader(bytes.NewReader(plain), int64(len(plain))); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = DetectContainer(r); err != nil || c.Type != PlainZip {
+		t.Errorf("seekable plain: %+v, %v", c, err)
+	}
+}
@@ -26,3 +26,11 @@ func (r *crcReader) Read(b []byte) (n int, err error) {
 	}
 	return
 }
+
+func (r *crcReader) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = copyBuffer(io.MultiWriter(w, r.hash), r.Reader)
+	if err == nil && r.crc != nil && *r.crc != 0 && r.hash.Sum32() != *r.crc {
+		err = zip.ErrChecksum
+	}
+	return
+}
@@ -5,96 +5,214 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+)
+
+const (
+	// maxDescriptorLen is the length of a zip64 data descriptor with its
+	// optional signature.
+	maxDescriptorLen = 24
 
-	"github.com/klauspost/compress/zip"
+	// descriptorLookahead is the number of bytes that have to be buffered
+	// past a position before it can be ruled out as the end of the content:
+	// the longest data descriptor and the signature that follows it.
+	descriptorLookahead = maxDescriptorLen + 4
 )
 
+// A descriptorForm is a layout of a data descriptor.
+type descriptorForm struct {
+	len       int
+	signature bool
+	zip64     bool
+}
+
+// descriptorForms are the layouts of a data descriptor, in the order they
+// are tried.
+var descriptorForms = []descriptorForm{
+	{16, true, false},
+	{12, false, false},
+	{24, true, true},
+	{20, false, true},
+}
+
+// descriptorReader reads the compressed content of an entry whose size is
+// only given in the data descriptor that follows it. The end of the content
+// is found by looking for the signature of the next header, preceded by a
+// descriptor whose compressed size matches the bytes read.
+//
+// The content is read straight out of the buffer of br: each buffered byte
+// is examined once, and WriteTo hands the buffer to the writer without
+// copying it.
 type descriptorReader struct {
-	br         *bufio.Reader
-	size       uint64
-	eof        bool
-	fileHeader *zip.FileHeader
+	br    *bufio.Reader
+	size  uint64 // bytes of content returned so far
+	entry *Entry
+
+	// Until the descriptor is found, scanned is the number of buffered
+	// bytes already searched for a signature. Once it is found, left is
+	// the number of bytes of content still buffered and skip the length
+	// of the descriptor after them.
+	scanned int
+	found   bool
+	left    int
+	skip    int
 }
 
 var (
 	sigBytes = []byte{0x50, 0x4b}
 )
 
-func (r *descriptorReader) Read(p []byte) (n int, err error) {
-	if r.eof {
-		return 0, io.EOF
+func (r *descriptorReader) Read(p []byte) (int, error) {
+	z, err := r.content()
+	if len(z) == 0 {
+		return 0, err
 	}
-
-	if n = len(p); n > maxRead {
-		n = maxRead
+	n := copy(p, z)
+	r.discard(n)
+	if r.found && r.left == 0 {
+		// Consume the descriptor now: a decompressor may not read on
+		// once it has the end of its stream.
+		_, err = r.content()
+		return n, err
 	}
+	return n, nil
+}
 
-	z, err := r.br.Peek(n + readAhead)
-	if err != nil {
-		if err == io.EOF && len(z) < 46+22 { // Min length of Central directory + End of central directory
-			return 0, err
+func (r *descriptorReader) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		z, err := r.content()
+		if len(z) == 0 {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
 		}
-		n = len(z)
+		m, err := w.Write(z)
+		r.discard(m)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// discard consumes n bytes returned by content.
+func (r *descriptorReader) discard(n int) {
+	r.br.Discard(n)
+	r.size += uint64(n)
+	if r.found {
+		r.left -= n
+	} else {
+		r.scanned -= n
 	}
+}
 
-	// Look for header of next file or central directory
-	discard := n
-	s := 16
-	for !r.eof && s < n {
+// content returns the buffered bytes that are known to be content, reading
+// more from the stream if there are none. It returns io.EOF, after
+// consuming the data descriptor, at the end of the content.
+func (r *descriptorReader) content() ([]byte, error) {
+	if r.found {
+		if r.left == 0 {
+			r.br.Discard(r.skip)
+			r.skip = 0
+			return nil, io.EOF
+		}
+		return r.br.Peek(r.left)
+	}
 
-		//Determine if we have enough buffer data to read
-		if s >= len(z)-4 {
-			r.eof = true
-			return n, io.EOF
+	for {
+		z, err := r.br.Peek(r.br.Buffered())
+		if len(z) < r.scanned+descriptorLookahead+1 {
+			// Wait for as much as a single read returns rather than
+			// for a full buffer.
+			if z, err = r.br.Peek(r.scanned + descriptorLookahead + 1); err == nil {
+				z, _ = r.br.Peek(r.br.Buffered())
+			}
 		}
 
-		i := bytes.Index(z[s:len(z)-4], sigBytes) + s
-		if i == -1 {
-			break
+		for r.scanned+4 <= len(z) {
+			i := bytes.Index(z[r.scanned:], sigBytes)
+			if i < 0 {
+				// The last byte could start a signature.
+				r.scanned = len(z) - 1
+				break
+			}
+			j := r.scanned + i
+			if j+4 > len(z) {
+				r.scanned = j
+				break
+			}
+			if n, ok := r.descriptor(z, j); ok {
+				r.found, r.left, r.skip = true, n, j-n
+				return r.content()
+			}
+			r.scanned = j + 1
 		}
 
-		// If directoryHeaderSignature or fileHeaderSignature file could be finished
-		if sig := binary.LittleEndian.Uint32(z[i : i+4]); sig == fileHeaderSignature ||
-			sig == directoryHeaderSignature {
-
-			// Now check for compressed file sizes to ensure not false positive and if zip64.
-
-			if i < len(z)-8 { // Zip32
-				// Zip32 optional dataDescriptorSignature
-				offset := 0
-				if binary.LittleEndian.Uint32(z[i-16:i-12]) == dataDescriptorSignature {
-					offset = 4
-				}
-
-				// Zip32 compressed file size
-				if binary.LittleEndian.Uint32(z[i-8:i-4]) == uint32(r.size)+uint32(i-12-offset) {
-					n, discard = i-12-offset, i
-					r.eof = true
-					r.fileHeader.CRC32 = binary.LittleEndian.Uint32(z[i-12 : i-8])
-					break
-				}
+		// A position is ruled out as the end of the content once every
+		// place a signature could follow a descriptor there is searched.
+		if n := r.scanned - maxDescriptorLen; n > 0 {
+			return z[:n], nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
 			}
+			return nil, err
+		}
+	}
+}
 
-			if i > 24 {
-				// Zip64 optional dataDescriptorSignature
-				offset := 0
-				if binary.LittleEndian.Uint32(z[i-24:i-20]) == dataDescriptorSignature {
-					offset = 4
-				}
-
-				// Zip64 compressed file size
-				if i >= 8 && binary.LittleEndian.Uint64(z[i-16:i-8]) == r.size+uint64(i-20-offset) {
-					n, discard = i-20-offset, i
-					r.eof = true
-					break
-				}
+// descriptor reports whether z[j:] starts with the signature of a header
+// following a data descriptor of the content, and if so returns the length
+// of the content before it. The descriptor is stored in the file header.
+func (r *descriptorReader) descriptor(z []byte, j int) (int, bool) {
+	if sig := binary.LittleEndian.Uint32(z[j:]); sig != fileHeaderSignature &&
+		sig != directoryHeaderSignature {
+		return 0, false
+	}
+	for i := range descriptorForms {
+		form := &descriptorForms[i]
+		n := j - form.len
+		if n < 0 {
+			continue
+		}
+		b := z[n:j]
+		if form.signature {
+			if binary.LittleEndian.Uint32(b) != dataDescriptorSignature {
+				continue
 			}
+			b = b[4:]
+		}
+
+		size := r.size + uint64(n)
+		var csize, usize uint64
+		if form.zip64 {
+			csize = binary.LittleEndian.Uint64(b[4:])
+			usize = binary.LittleEndian.Uint64(b[12:])
+		} else {
+			csize = uint64(binary.LittleEndian.Uint32(b[4:]))
+			usize = uint64(binary.LittleEndian.Uint32(b[8:]))
+			size &= 0xffffffff
+		}
+		if csize != size {
+			continue
 		}
 
-		s = i + 2
+		r.entry.descriptor = form
+		f := r.entry.FileHeader
+		f.CRC32 = binary.LittleEndian.Uint32(b)
+		f.CompressedSize64 = r.size + uint64(n)
+		f.UncompressedSize64 = usize
+		f.CompressedSize = uint32(min64(f.CompressedSize64, 0xffffffff))
+		f.UncompressedSize = uint32(min64(f.UncompressedSize64, 0xffffffff))
+		return n, true
 	}
-	copy(p, z[:n])
-	r.br.Discard(discard)
-	r.size += uint64(n)
-	return
+	return 0, false
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
 }
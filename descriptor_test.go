@@ -0,0 +1,155 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// descriptorZip builds an archive of stored entries whose sizes and CRC-32
+// are only given in a data descriptor, which zip.Writer cannot produce in
+// all variants.
+func descriptorZip(contents [][]byte, signature, zip64 bool) []byte {
+	var buf, dir bytes.Buffer
+	le := func(w *bytes.Buffer, vs ...interface{}) {
+		for _, v := range vs {
+			binary.Write(w, binary.LittleEndian, v)
+		}
+	}
+	for i, content := range contents {
+		name := fmt.Sprint(i)
+		offset := buf.Len()
+		crc := crc32.ChecksumIEEE(content)
+		le(&buf, uint32(fileHeaderSignature), uint16(45), uint16(0x8), Store,
+			uint32(0), uint32(0), uint32(0), uint32(0), uint16(len(name)), uint16(0))
+		buf.WriteString(name)
+		buf.Write(content)
+		if signature {
+			le(&buf, uint32(dataDescriptorSignature))
+		}
+		if zip64 {
+			le(&buf, crc, uint64(len(content)), uint64(len(content)))
+		} else {
+			le(&buf, crc, uint32(len(content)), uint32(len(content)))
+		}
+
+		le(&dir, uint32(directoryHeaderSignature), uint16(45), uint16(45), uint16(0x8), Store,
+			uint32(0), crc, uint32(len(content)), uint32(len(content)), uint16(len(name)),
+			uint16(0), uint16(0), uint16(0), uint16(0), uint32(0), uint32(offset))
+		dir.WriteString(name)
+	}
+	dirOffset := buf.Len()
+	buf.Write(dir.Bytes())
+	le(&buf, uint32(directoryEndSignature), uint16(0), uint16(0), uint16(len(contents)),
+		uint16(len(contents)), uint32(dir.Len()), uint32(dirOffset), uint16(0))
+	return buf.Bytes()
+}
+
+func TestDescriptorReader(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 3*bufferSize+17)
+	rnd.Read(random)
+	// Content that looks like the end of an entry followed by a header.
+	fake := []byte("data\x50\x4b\x07\x08\x00\x00\x00\x00\x07\x00\x00\x00\x07\x00\x00\x00\x50\x4b\x03\x04more")
+
+	contents := [][]byte{
+		{},
+		[]byte("short"),
+		fake,
+		{},
+		random,
+		bytes.Repeat(fake, bufferSize/len(fake)+1),
+		random[:bufferSize-27],
+		{},
+	}
+	for _, signature := range []bool{false, true} {
+		for _, zip64 := range []bool{false, true} {
+			z := descriptorZip(contents, signature, zip64)
+			for _, workers := range []int{0, 2} {
+				r := NewReader(bytes.NewReader(z))
+				r.SetConcurrency(workers, 1<<20)
+				for i := 0; ; i++ {
+					h, err := r.Next()
+					if err == io.EOF {
+						if i != len(contents) {
+							t.Errorf("signature %v, zip64 %v: read %d entries, want %d", signature, zip64, i, len(contents))
+						}
+						break
+					}
+					if err != nil {
+						t.Fatalf("signature %v, zip64 %v, entry %d: %v", signature, zip64, i, err)
+					}
+					var b []byte
+					if i%2 == 0 {
+						b, err = ioutil.ReadAll(r)
+					} else {
+						var out bytes.Buffer
+						_, err = io.Copy(writerOnly{&out}, r)
+						b = out.Bytes()
+					}
+					if err != nil {
+						t.Fatalf("signature %v, zip64 %v, entry %d: %v", signature, zip64, i, err)
+					}
+					if !bytes.Equal(b, contents[i]) {
+						t.Fatalf("signature %v, zip64 %v, entry %d: read %d bytes, want %d", signature, zip64, i, len(b), len(contents[i]))
+					}
+					if h.CRC32 != crc32.ChecksumIEEE(b) || h.UncompressedSize64 != uint64(len(b)) {
+						t.Errorf("signature %v, zip64 %v, entry %d: descriptor not applied to header", signature, zip64, i)
+					}
+				}
+			}
+		}
+	}
+}
+
+func benchmarkZip(b *testing.B, size int, method uint16, descriptor bool) []byte {
+	content := make([]byte, size)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range content {
+		// Compressible, but not trivially.
+		content[i] = "abcdefghijklmnopqrstuvwxyz \n"[rnd.Intn(28)]
+	}
+
+	var entries []testEntry
+	for i := 0; i < 4; i++ {
+		e := deflated(fmt.Sprint(i), string(content))
+		e.h.Method, e.sized = method, !descriptor
+		entries = append(entries, e)
+	}
+	return testZip(b, "", entries...)
+}
+
+func BenchmarkReader(b *testing.B) {
+	for _, method := range []uint16{Store, Deflate} {
+		for _, descriptor := range []bool{true, false} {
+			for _, size := range []int{1 << 10, 64 << 10, 1 << 20, 16 << 20} {
+				name := fmt.Sprintf("method=%d/descriptor=%v/size=%d", method, descriptor, size)
+				b.Run(name, func(b *testing.B) {
+					z := benchmarkZip(b, size, method, descriptor)
+					b.SetBytes(4 * int64(size))
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						r := NewReader(bytes.NewReader(z))
+						for {
+							_, err := r.Next()
+							if err == io.EOF {
+								break
+							}
+							if err != nil {
+								b.Fatal(err)
+							}
+							if _, err := io.Copy(ioutil.Discard, r); err != nil {
+								b.Fatal(err)
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package zipstream
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A Digest names a hash function to compute over the content of entries.
+// Any hash.Hash can be used, not only those provided here.
+type Digest struct {
+	Name string
+	New  func() hash.Hash
+}
+
+// Digests provided by the package.
+var (
+	SHA256     = Digest{Name: "sha256", New: sha256.New}
+	SHA384     = Digest{Name: "sha384", New: sha512.New384}
+	SHA512     = Digest{Name: "sha512", New: sha512.New}
+	SHA1       = Digest{Name: "sha1", New: sha1.New}
+	MD5        = Digest{Name: "md5", New: md5.New}
+	BLAKE2b256 = Digest{Name: "blake2b-256", New: func() hash.Hash { h, _ := blake2b.New256(nil); return h }}
+	BLAKE2b512 = Digest{Name: "blake2b-512", New: func() hash.Hash { h, _ := blake2b.New512(nil); return h }}
+)
+
+// digestReader hashes everything read through it. Once the reader returns
+// io.EOF, sums holds the digests keyed by name.
+type digestReader struct {
+	io.Reader
+	digests []Digest
+	hashes  []hash.Hash
+	w       io.Writer
+	sums    map[string][]byte
+
+	// raw hashes the compressed bytes the content was read from. A
+	// decompressor may stop short of the end of its input, so raw is
+	// drained when the content is finished.
+	raw *digestReader
+}
+
+func newDigestReader(r io.Reader, digests []Digest) *digestReader {
+	d := &digestReader{Reader: r, digests: digests}
+	ws := make([]io.Writer, len(digests))
+	for i, dg := range digests {
+		h := dg.New()
+		d.hashes = append(d.hashes, h)
+		ws[i] = h
+	}
+	d.w = io.MultiWriter(ws...)
+	return d
+}
+
+func (d *digestReader) Read(b []byte) (n int, err error) {
+	n, err = d.Reader.Read(b)
+	d.w.Write(b[:n])
+	if err == io.EOF && d.sums == nil {
+		if d.raw != nil {
+			if _, err := io.Copy(ioutil.Discard, d.raw); err != nil {
+				return n, err
+			}
+			d.raw.finish()
+		}
+		d.finish()
+	}
+	return
+}
+
+func (d *digestReader) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = copyBuffer(io.MultiWriter(w, d.w), d.Reader)
+	if err == nil && d.sums == nil {
+		if d.raw != nil {
+			if _, err := io.Copy(ioutil.Discard, d.raw); err != nil {
+				return n, err
+			}
+			d.raw.finish()
+		}
+		d.finish()
+	}
+	return
+}
+
+func (d *digestReader) finish() {
+	if d.sums != nil {
+		return
+	}
+	d.sums = make(map[string][]byte, len(d.hashes))
+	for i, h := range d.hashes {
+		d.sums[d.digests[i].Name] = h.Sum(nil)
+	}
+}
+
+// SetDigests selects the digests computed over the uncompressed content of
+// every entry, on top of the CRC-32 check.
+func (r *Reader) SetDigests(digests ...Digest) {
+	r.digests = digests
+}
+
+// SetRawDigests selects the digests computed over the compressed content of
+// every entry, as it is stored in the archive.
+func (r *Reader) SetRawDigests(digests ...Digest) {
+	r.rawDigests = digests
+}
+
+// Digests returns the digests selected with SetDigests of the current entry,
+// as returned by Entry.Digests.
+func (r *Reader) Digests() map[string][]byte {
+	if r.entry == nil {
+		return nil
+	}
+	return r.entry.Digests()
+}
+
+// RawDigests returns the digests selected with SetRawDigests of the current
+// entry, as returned by Entry.RawDigests.
+func (r *Reader) RawDigests() map[string][]byte {
+	if r.entry == nil {
+		return nil
+	}
+	return r.entry.RawDigests()
+}
@@ -0,0 +1,69 @@
+package zipstream
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func TestDigests(t *testing.T) {
+	content := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(content[:50000]) // half incompressible
+
+	stored := deflated("file", string(content))
+	stored.h.Method = Store
+	buf := bytes.NewBuffer(testZip(t, "", stored, deflated("file", string(content))))
+
+	// The compressed bytes, as archive/zip sees them.
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw [][]byte
+	for _, f := range zr.File {
+		rr, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rr)
+		raw = append(raw, b)
+	}
+
+	r := NewReader(buf)
+	r.SetDigests(SHA256, MD5)
+	r.SetRawDigests(SHA256)
+	for i := 0; ; i++ {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Digests() != nil {
+			t.Error("Digests available before the entry was read")
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+
+		sha := sha256.Sum256(content)
+		sum := md5.Sum(content)
+		rawSHA := sha256.Sum256(raw[i])
+		if got := r.Digests()["sha256"]; !bytes.Equal(got, sha[:]) {
+			t.Errorf("entry %d: sha256 = %x, want %x", i, got, sha)
+		}
+		if got := r.Digests()["md5"]; !bytes.Equal(got, sum[:]) {
+			t.Errorf("entry %d: md5 = %x, want %x", i, got, sum)
+		}
+		if got := r.RawDigests()["sha256"]; !bytes.Equal(got, rawSHA[:]) {
+			t.Errorf("entry %d: raw sha256 = %x, want %x", i, got, rawSHA)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// An Entry describes an entry of an archive read by a Reader.
+//
+// The embedded FileHeader is the one returned by Next, so it receives the
+// updates the Reader makes to it, such as the CRC-32 from a data descriptor
+// and the mode from the central directory.
+type Entry struct {
+	*zip.FileHeader
+
+	// HeaderOffset and DataOffset are the positions in the stream of the
+	// local file header and of the content of the entry.
+	HeaderOffset int64
+	DataOffset   int64
+
+	// Archive is the index of the archive of the entry in a stream of
+	// archives that follow each other, counting from 0.
+	Archive int
+
+	// RawName is the name as stored in the local file header.
+	RawName []byte
+
+	// Extras is the decoded form of the extra fields.
+	Extras *Extras
+
+	// DataDescriptor reports whether the CRC-32 and sizes follow the
+	// content in a data descriptor rather than preceding it in the header.
+	DataDescriptor bool
+
+	// Truncated reports whether the stream ended in the middle of the
+	// content, which was then read as far as it went. It is only set in
+	// recovery mode.
+	Truncated bool
+
+	digest     *digestReader
+	descriptor *descriptorForm // of the data descriptor, once read
+}
+
+// Digests returns the digests selected with Reader.SetDigests, keyed by
+// name. It returns nil until the entry has been read to the end, and never
+// returns digests of content that failed the CRC-32 check.
+func (e *Entry) Digests() map[string][]byte {
+	if e.digest == nil {
+		return nil
+	}
+	return e.digest.sums
+}
+
+// RawDigests returns the digests selected with Reader.SetRawDigests, keyed
+// by name. It returns nil until the entry has been read to the end.
+func (e *Entry) RawDigests() map[string][]byte {
+	if e.digest == nil || e.digest.raw == nil {
+		return nil
+	}
+	return e.digest.raw.sums
+}
+
+// Entry returns the current entry, the one last returned by Next.
+func (r *Reader) Entry() *Entry {
+	return r.entry
+}
+
+var (
+	// SkipEntry is returned by a WalkFunc to move on to the next entry
+	// without reading the rest of the content of the current one.
+	SkipEntry = errors.New("zipstream: skip this entry")
+
+	// StopWalk is returned by a WalkFunc to end Walk without an error.
+	StopWalk = errors.New("zipstream: stop walk")
+)
+
+// A WalkFunc is called by Walk for each entry, with a reader of its content.
+type WalkFunc func(e *Entry, content io.Reader) error
+
+// Walk calls fn for each entry of the next archive in r, until Next returns
+// io.EOF.
+//
+// Whatever fn leaves of the content is read once it returns nil, so that
+// the CRC-32 is verified and digests are available on the Entry; an error
+// from doing so ends the walk. If fn returns SkipEntry the rest of the
+// content is discarded without being decompressed or verified. If it
+// returns StopWalk, Walk returns nil, and any other error is returned as is.
+func (r *Reader) Walk(fn WalkFunc) error {
+	for {
+		if _, err := r.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch err := fn(r.entry, r); err {
+		case nil:
+			if _, err := io.Copy(ioutil.Discard, r); err != nil {
+				return err
+			}
+		case SkipEntry:
+			if err := r.skipEntry(); err != nil {
+				return err
+			}
+		case StopWalk:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// Skip discards the rest of the compressed content of the current entry
+// without decompressing or verifying it. Unlike reading the entry, it also
+// moves past an entry that Next could not open, failing with
+// zip.ErrAlgorithm, so that the entries after it can be read.
+func (r *Reader) Skip() error {
+	if r.unsupported {
+		r.unsupported = false
+		return r.skipUnsupported()
+	}
+	return r.skipEntry()
+}
+
+// skipEntry discards the rest of the compressed content of the current
+// entry.
+func (r *Reader) skipEntry() error {
+	if r.raw == nil { // Nothing left to read, or already read ahead
+		r.closeEntry()
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, r.raw)
+	if err != nil && r.salvage != nil && r.streamEnded() && r.truncated(r.entry, err) {
+		r.entry.Truncated = true
+		r.salvage.Truncated = r.entry
+		err = nil
+	}
+	r.closeEntry()
+	return err
+}
+
+// skipUnsupported discards the compressed content of the current entry,
+// which Next could not open for lack of a decompressor or as its sizes
+// exceed the limits.
+func (r *Reader) skipUnsupported() error {
+	e := r.entry
+	var raw io.Reader = io.LimitReader(r.br, int64(e.CompressedSize64))
+	if e.DataDescriptor && r.seekable == nil {
+		raw = &descriptorReader{br: r.br, entry: e}
+	}
+	_, err := io.Copy(ioutil.Discard, raw)
+	return err
+}
@@ -0,0 +1,117 @@
+package zipstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func walkZip(t *testing.T, names ...string) []byte {
+	var entries []testEntry
+	for _, name := range names {
+		entries = append(entries, deflated(name, strings.Repeat(name, 1000)))
+	}
+	return testZip(t, "junk", entries...)
+}
+
+func TestWalk(t *testing.T) {
+	r := NewReader(bytes.NewReader(walkZip(t, "a", "b", "c", "d")))
+	r.SetDigests(SHA256)
+
+	var entries []*Entry
+	err := r.Walk(func(e *Entry, content io.Reader) error {
+		entries = append(entries, e)
+		switch e.Name {
+		case "a":
+			// Leave most of the content to Walk.
+			_, err := content.Read(make([]byte, 10))
+			return err
+		case "b":
+			return SkipEntry
+		case "c":
+			return StopWalk
+		}
+		t.Errorf("walked past StopWalk to %q", e.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("walked %d entries, want 3", len(entries))
+	}
+
+	a := entries[0]
+	if a.HeaderOffset != 4 || a.DataOffset != 4+fileHeaderLen+1 {
+		t.Errorf("offsets = %d, %d, want 4, %d", a.HeaderOffset, a.DataOffset, 4+fileHeaderLen+1)
+	}
+	if !a.DataDescriptor {
+		t.Error("DataDescriptor = false, want true")
+	}
+	sum := sha256.Sum256(bytes.Repeat([]byte("a"), 1000))
+	if got := a.Digests()["sha256"]; !bytes.Equal(got, sum[:]) {
+		t.Errorf("sha256 = %x, want %x", got, sum)
+	}
+	if entries[1].Digests() != nil {
+		t.Error("skipped entry has digests")
+	}
+	if b := entries[1]; b.HeaderOffset <= a.DataOffset {
+		t.Errorf("entry b at %d, before the content of a at %d", b.HeaderOffset, a.DataOffset)
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	errTest := errors.New("test")
+	r := NewReader(bytes.NewReader(walkZip(t, "a", "b")))
+	n := 0
+	err := r.Walk(func(e *Entry, content io.Reader) error {
+		n++
+		return errTest
+	})
+	if err != errTest || n != 1 {
+		t.Fatalf("Walk = %v after %d entries, want %v after 1", err, n, errTest)
+	}
+
+	// SkipEntry still lands on every entry.
+	r = NewReader(bytes.NewReader(walkZip(t, "a", "b", "c")))
+	n = 0
+	err = r.Walk(func(e *Entry, content io.Reader) error {
+		n++
+		return SkipEntry
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("Walk = %v after %d entries, want nil after 3", err, n)
+	}
+}
+
+func TestSkipUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "packed.bz2", Method: 12, CompressedSize64: 5, UncompressedSize64: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("BZh91"))
+	w, _ = zw.Create("after")
+	w.Write([]byte("after"))
+	zw.Close()
+
+	r := NewReader(&buf)
+	if _, err := r.Next(); err != zip.ErrAlgorithm {
+		t.Fatalf("Next: %v, want %v", err, zip.ErrAlgorithm)
+	}
+	if err := r.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Skip(); err != nil { // already skipped
+		t.Fatal(err)
+	}
+	if f, err := r.Next(); err != nil || f.Name != "after" {
+		t.Fatalf("next: %v %v", f, err)
+	}
+}
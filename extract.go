@@ -0,0 +1,251 @@
+package zipstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+)
+
+var (
+	// ErrInsecurePath is returned when an entry name or a symbolic link
+	// target would place a file outside of the destination directory.
+	ErrInsecurePath = errors.New("zipstream: insecure file path")
+
+	// ErrSymlink is returned by an Extractor using SymlinkError when the
+	// archive contains a symbolic link.
+	ErrSymlink = errors.New("zipstream: archive contains a symbolic link")
+)
+
+// A SymlinkPolicy controls how an Extractor handles symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinkSkip leaves symbolic links out of the extracted tree.
+	SymlinkSkip SymlinkPolicy = iota
+
+	// SymlinkAsFile writes the link target as the content of a regular file,
+	// which is what archivers unaware of symbolic links do.
+	SymlinkAsFile
+
+	// SymlinkCreate creates symbolic links whose target stays within the
+	// destination directory and fails with ErrInsecurePath otherwise. Links
+	// placed in, or pointing through, another link are refused too.
+	SymlinkCreate
+
+	// SymlinkError fails the extraction with ErrSymlink.
+	SymlinkError
+)
+
+// An Extractor writes the entries of a zip archive to a directory.
+//
+// Entry names that are absolute or climb out of Dir are rejected with
+// ErrInsecurePath. Symbolic links are created only once the whole archive
+// has been read, both because their mode is usually only known from the
+// central directory and so that no file can be written through them.
+type Extractor struct {
+	// Dir is the destination directory. It is created if necessary.
+	Dir string
+
+	// Symlinks selects how symbolic links are handled.
+	Symlinks SymlinkPolicy
+}
+
+type extractedLink struct {
+	name, target string
+}
+
+// Extract extracts the entries of the next archive in r until Next
+// returns io.EOF.
+func (x *Extractor) Extract(r *Reader) error {
+	var (
+		links   []extractedLink
+		unknown = make(map[*zip.FileHeader]string) // files whose mode was not known yet
+	)
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := localName(f.Name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(x.Dir, filepath.FromSlash(name))
+
+		switch {
+		case strings.HasSuffix(f.Name, "/"):
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case IsSymlink(f):
+			target, err := r.LinkTarget()
+			if err != nil {
+				return err
+			}
+			links = append(links, extractedLink{name, target})
+		default:
+			if err := writeFile(dst, r, f.Mode().Perm()); err != nil {
+				return err
+			}
+			if !modeKnown(f) {
+				unknown[f] = name
+			}
+		}
+	}
+
+	// The central directory has been read by now, which may turn some of
+	// the regular files written above into symbolic links.
+	for f, name := range unknown {
+		if !IsSymlink(f) {
+			continue
+		}
+		dst := filepath.Join(x.Dir, filepath.FromSlash(name))
+		if x.Symlinks == SymlinkAsFile {
+			continue // already written as such
+		}
+		target, err := readLinkFile(dst)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+		links = append(links, extractedLink{name, target})
+	}
+
+	names := make(map[string]bool, len(links))
+	for _, l := range links {
+		names[l.name] = true
+	}
+	for _, l := range links {
+		if err := x.link(l.name, l.target, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLinkFile reads the target of a symbolic link written as a regular file
+// at name, returning ErrLinkTarget if it is too long, as LinkTarget does.
+func readLinkFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(f, maxLinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxLinkTarget {
+		return "", ErrLinkTarget
+	}
+	return string(b), nil
+}
+
+// link creates the symbolic link name to target, links being the names of
+// all the links of the archive.
+func (x *Extractor) link(name, target string, links map[string]bool) error {
+	dst := filepath.Join(x.Dir, filepath.FromSlash(name))
+	switch x.Symlinks {
+	case SymlinkAsFile:
+		return writeFile(dst, strings.NewReader(target), 0644)
+	case SymlinkCreate:
+		if x.insecureLink(name, target, links) {
+			return fmt.Errorf("%w: %s -> %s", ErrInsecurePath, name, target)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(filepath.FromSlash(target), dst)
+	case SymlinkError:
+		return fmt.Errorf("%w: %s", ErrSymlink, name)
+	}
+	return nil
+}
+
+// insecureLink reports whether the link name to target could resolve
+// outside of Dir. Checking the target as text is only sound if neither the
+// link nor its target go through another link, which may point anywhere
+// inside Dir and so climb out of it with a few "..", so both are refused.
+// The links of the archive count whether they are created yet or not.
+func (x *Extractor) insecureLink(name, target string, links map[string]bool) bool {
+	if path.IsAbs(target) || strings.HasPrefix(target, `\`) {
+		return true
+	}
+	isLink := func(elems []string) bool {
+		p := path.Join(elems...)
+		if links[p] {
+			return true
+		}
+		fi, err := os.Lstat(filepath.Join(x.Dir, filepath.FromSlash(p)))
+		return err == nil && fi.Mode()&os.ModeSymlink != 0
+	}
+
+	var elems []string
+	if dir := path.Dir(name); dir != "." {
+		for _, elem := range strings.Split(dir, "/") {
+			elems = append(elems, elem)
+			if isLink(elems) {
+				return true
+			}
+		}
+	}
+	targetElems := strings.Split(strings.ReplaceAll(target, `\`, "/"), "/")
+	for i, elem := range targetElems {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(elems) == 0 {
+				return true
+			}
+			elems = elems[:len(elems)-1]
+		default:
+			elems = append(elems, elem)
+			if i < len(targetElems)-1 && isLink(elems) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// localName returns the cleaned, slash-separated form of an entry name,
+// or ErrInsecurePath if it would escape the destination directory.
+func localName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == "." || clean == ".." || path.IsAbs(clean) ||
+		strings.HasPrefix(clean, "../") || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("%w: %s", ErrInsecurePath, name)
+	}
+	return clean, nil
+}
+
+func writeFile(dst string, r io.Reader, perm os.FileMode) error {
+	if perm == 0 {
+		perm = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,215 @@
+package zipstream
+
+import (
+	"time"
+)
+
+// Extra header IDs not known to archive/zip.
+const (
+	asiUnixExtraID        = 0x756e // ASi Unix extension
+	infoZipNewUnixExtraID = 0x7875 // Info-ZIP new Unix extension (UID/GID)
+	unicodePathExtraID    = 0x7075 // Info-ZIP Unicode Path
+	unicodeCommentExtraID = 0x6375 // Info-ZIP Unicode Comment
+	androidAlignExtraID   = 0xd935 // Android zipalign alignment
+	jarMarkerExtraID      = 0xcafe // JAR marker
+)
+
+// An ExtraField is a raw extra field.
+type ExtraField struct {
+	ID   uint16
+	Data []byte
+}
+
+// A UnicodeField is an Info-ZIP Unicode Path or Unicode Comment extra field,
+// holding the UTF-8 form of a name or comment stored in another encoding.
+type UnicodeField struct {
+	Version uint8
+	CRC32   uint32 // CRC-32 of the name or comment as stored in the header
+	Value   string // UTF-8
+}
+
+// Extras is the decoded form of the extra fields of a file header.
+//
+// Fields that do not appear in the header keep their zero value, except
+// UID and GID which are -1. When several fields carry the same information
+// the one appearing last wins, as for FileHeader.Modified.
+type Extras struct {
+	// Modified, Accessed and Created are taken from the NTFS (0x000a),
+	// extended timestamp (0x5455) and Unix (0x000d, 0x5855) fields.
+	// They are in UTC.
+	Modified time.Time
+	Accessed time.Time
+	Created  time.Time
+
+	// UID and GID are taken from the Info-ZIP Unix (0x7875), ASi Unix
+	// (0x756e) and older Unix (0x000d, 0x5855) fields.
+	UID int
+	GID int
+
+	// UnixMode is the st_mode of the file from the ASi Unix field (0x756e)
+	// and LinkTarget the symbolic link target it may hold.
+	UnixMode   uint32
+	LinkTarget string
+
+	// UnicodePath and UnicodeComment are the Info-ZIP Unicode Path (0x7075)
+	// and Unicode Comment (0x6375) fields.
+	UnicodePath    *UnicodeField
+	UnicodeComment *UnicodeField
+
+	// Alignment is the alignment requested by the Android zipalign
+	// field (0xd935).
+	Alignment int
+
+	// JAR reports whether the JAR marker (0xcafe) is present.
+	JAR bool
+
+	// Unknown holds the fields that are not decoded, in order.
+	// The zip64 field (0x0001) is decoded by the Reader itself and is not
+	// included.
+	Unknown []ExtraField
+}
+
+// ParseExtras decodes the extra fields of a local or central file header.
+// Malformed fields are skipped, and decoding stops at the first field whose
+// size runs past the end of extra.
+func ParseExtras(extra []byte) *Extras {
+	x := &Extras{UID: -1, GID: -1}
+
+parseExtras:
+	for extra := readBuf(extra); len(extra) >= 4; { // need at least tag and size
+		fieldTag := extra.uint16()
+		fieldSize := int(extra.uint16())
+		if len(extra) < fieldSize {
+			break
+		}
+		fieldBuf := extra.sub(fieldSize)
+
+		switch fieldTag {
+		case zip64ExtraID:
+			// Sizes are resolved by readFileHeader and readDirectoryHeader.
+		case ntfsExtraID:
+			if len(fieldBuf) < 4 {
+				continue parseExtras
+			}
+			fieldBuf.uint32()        // reserved (ignored)
+			for len(fieldBuf) >= 4 { // need at least tag and size
+				attrTag := fieldBuf.uint16()
+				attrSize := int(fieldBuf.uint16())
+				if len(fieldBuf) < attrSize {
+					continue parseExtras
+				}
+				attrBuf := fieldBuf.sub(attrSize)
+				if attrTag != 1 || attrSize != 24 {
+					continue // Ignore irrelevant attributes
+				}
+				x.Modified = ntfsTime(attrBuf.uint64())
+				x.Accessed = ntfsTime(attrBuf.uint64())
+				x.Created = ntfsTime(attrBuf.uint64())
+			}
+		case unixExtraID, infoZipUnixExtraID:
+			if len(fieldBuf) < 8 {
+				continue parseExtras
+			}
+			x.Accessed = unixTime(fieldBuf.uint32())
+			x.Modified = unixTime(fieldBuf.uint32())
+			if len(fieldBuf) >= 4 { // Only present in local headers
+				x.UID = int(fieldBuf.uint16())
+				x.GID = int(fieldBuf.uint16())
+			}
+		case extTimeExtraID:
+			if len(fieldBuf) < 1 {
+				continue parseExtras
+			}
+			// Central headers only carry the modification time,
+			// whatever the flags say.
+			flags := fieldBuf.uint8()
+			for i, t := range []*time.Time{&x.Modified, &x.Accessed, &x.Created} {
+				if flags&(1<<uint(i)) == 0 {
+					continue
+				}
+				if len(fieldBuf) < 4 {
+					continue parseExtras
+				}
+				*t = unixTime(fieldBuf.uint32())
+			}
+		case infoZipNewUnixExtraID:
+			if len(fieldBuf) < 2 || fieldBuf.uint8() != 1 {
+				continue parseExtras
+			}
+			uid, ok := fieldBuf.uintN()
+			if !ok {
+				continue parseExtras
+			}
+			gid, ok := fieldBuf.uintN()
+			if !ok {
+				continue parseExtras
+			}
+			x.UID, x.GID = int(uid), int(gid)
+		case asiUnixExtraID:
+			if len(fieldBuf) < 14 {
+				continue parseExtras
+			}
+			fieldBuf.uint32() // CRC of the rest of the field (ignored)
+			x.UnixMode = uint32(fieldBuf.uint16())
+			fieldBuf.uint32() // size of a device or link target (ignored)
+			x.UID = int(fieldBuf.uint16())
+			x.GID = int(fieldBuf.uint16())
+			x.LinkTarget = string(fieldBuf)
+		case unicodePathExtraID, unicodeCommentExtraID:
+			if len(fieldBuf) < 5 {
+				continue parseExtras
+			}
+			u := &UnicodeField{
+				Version: fieldBuf.uint8(),
+				CRC32:   fieldBuf.uint32(),
+				Value:   string(fieldBuf),
+			}
+			if fieldTag == unicodePathExtraID {
+				x.UnicodePath = u
+			} else {
+				x.UnicodeComment = u
+			}
+		case androidAlignExtraID:
+			if len(fieldBuf) < 2 {
+				continue parseExtras
+			}
+			x.Alignment = int(fieldBuf.uint16())
+		case jarMarkerExtraID:
+			x.JAR = true
+		default:
+			x.Unknown = append(x.Unknown, ExtraField{ID: fieldTag, Data: fieldBuf})
+		}
+	}
+	return x
+}
+
+// ntfsTime converts a count of 100ns ticks since the Windows epoch.
+func ntfsTime(ts uint64) time.Time {
+	const ticksPerSecond = 1e7 // Windows timestamp resolution
+	secs := int64(ts / ticksPerSecond)
+	nsecs := (1e9 / ticksPerSecond) * int64(ts%ticksPerSecond)
+	epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return time.Unix(epoch.Unix()+secs, nsecs).UTC()
+}
+
+// unixTime converts a count of seconds since the Unix epoch.
+func unixTime(ts uint32) time.Time {
+	return time.Unix(int64(ts), 0).UTC()
+}
+
+// uintN reads a little-endian unsigned integer preceded by its size in
+// bytes, as used by the Info-ZIP new Unix extra field.
+func (b *readBuf) uintN() (uint64, bool) {
+	if len(*b) < 1 {
+		return 0, false
+	}
+	n := int(b.uint8())
+	if n > 8 || len(*b) < n {
+		return 0, false
+	}
+	var v uint64
+	for i, c := range b.sub(n) {
+		v |= uint64(c) << (8 * uint(i))
+	}
+	return v, true
+}
@@ -0,0 +1,93 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func extraField(id uint16, data ...byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint16(b, id)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(data)))
+	return append(b, data...)
+}
+
+func TestParseExtras(t *testing.T) {
+	extra := bytes.Join([][]byte{
+		extraField(extTimeExtraID, 7, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0),
+		extraField(infoZipNewUnixExtraID, 1, 4, 0xe8, 3, 0, 0, 2, 0xe9, 3),
+		extraField(unicodePathExtraID, 1, 0xaa, 0xbb, 0xcc, 0xdd, 'n', 'a', 'm', 'e'),
+		extraField(unicodeCommentExtraID, 1, 0, 0, 0, 0),
+		extraField(androidAlignExtraID, 4, 0, 0, 0),
+		extraField(jarMarkerExtraID),
+		extraField(0x4242, 1, 2, 3),
+	}, nil)
+
+	want := &Extras{
+		Modified:       time.Unix(1, 0).UTC(),
+		Accessed:       time.Unix(2, 0).UTC(),
+		Created:        time.Unix(3, 0).UTC(),
+		UID:            1000,
+		GID:            1001,
+		UnicodePath:    &UnicodeField{Version: 1, CRC32: 0xddccbbaa, Value: "name"},
+		UnicodeComment: &UnicodeField{Version: 1, Value: ""},
+		Alignment:      4,
+		JAR:            true,
+		Unknown:        []ExtraField{{ID: 0x4242, Data: []byte{1, 2, 3}}},
+	}
+	if got := ParseExtras(extra); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExtras =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A truncated field ends decoding without losing what came before.
+	got := ParseExtras(append(extraField(jarMarkerExtraID), 0x42, 0x42, 9, 0))
+	if !got.JAR || got.Unknown != nil {
+		t.Errorf("ParseExtras(truncated) = %+v", got)
+	}
+}
+
+func TestParseExtrasNTFS(t *testing.T) {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint16(data[4:], 1)  // attribute tag
+	binary.LittleEndian.PutUint16(data[6:], 24) // attribute size
+	for i, ts := range []uint64{116444736000000000, 116444736010000000, 116444736020000005} {
+		binary.LittleEndian.PutUint64(data[8+8*i:], ts)
+	}
+
+	x := ParseExtras(extraField(ntfsExtraID, data...))
+	for _, tt := range []struct {
+		got, want time.Time
+	}{
+		{x.Modified, time.Unix(0, 0)},
+		{x.Accessed, time.Unix(1, 0)},
+		{x.Created, time.Unix(2, 500)},
+	} {
+		if !tt.got.Equal(tt.want) || tt.got.Location() != time.UTC {
+			t.Errorf("time = %v, want %v", tt.got, tt.want.UTC())
+		}
+	}
+}
+
+func TestParseExtrasOwner(t *testing.T) {
+	f, err := os.Open("testdata/unix.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h, err := NewReader(f).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := ParseExtras(h.Extra)
+	if x.UID != 1000 || x.GID != 1000 {
+		t.Errorf("UID, GID = %d, %d, want 1000, 1000", x.UID, x.GID)
+	}
+	if !x.Modified.Equal(h.Modified) {
+		t.Errorf("Modified = %v, header has %v", x.Modified, h.Modified)
+	}
+}
@@ -0,0 +1,75 @@
+package zipstream
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zip"
+)
+
+// A testEntry is an entry of an archive written by testZip.
+type testEntry struct {
+	h       zip.FileHeader
+	content string
+
+	// sized writes the entry with createSized, with only the name and
+	// method of h.
+	sized bool
+}
+
+// deflated returns an entry as zip.Writer.Create writes it.
+func deflated(name, content string) testEntry {
+	return testEntry{h: zip.FileHeader{Name: name, Method: Deflate}, content: content}
+}
+
+// testZip returns an archive of entries written by zip.Writer, after prefix
+// for junk at the start of the stream.
+func testZip(t testing.TB, prefix string, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(prefix)
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		if e.sized {
+			createSized(t, zw, e.h.Name, e.h.Method, []byte(e.content))
+			continue
+		}
+		h := e.h
+		w, err := zw.CreateHeader(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// createSized writes an entry whose sizes are known from its local file
+// header, which zip.Writer only does for raw entries.
+func createSized(t testing.TB, zw *zip.Writer, name string, method uint16, content []byte) {
+	var compressed bytes.Buffer
+	switch method {
+	case Store:
+		compressed.Write(content)
+	case Deflate:
+		fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+		fw.Write(content)
+		fw.Close()
+	}
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             method,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(compressed.Bytes())
+}
@@ -2,4 +2,7 @@ module github.com/xenking/zipstream
 
 go 1.16
 
-require github.com/klauspost/compress v1.13.6
+require (
+	github.com/klauspost/compress v1.13.6
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+)
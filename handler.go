@@ -0,0 +1,275 @@
+package zipstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// An EntryHandler is called by an UploadHandler for each entry of the
+// uploaded archive, with a reader of its content. An error fails the entry
+// in the summary, and the upload goes on with the next one.
+type EntryHandler func(ctx context.Context, e *Entry, content io.Reader) error
+
+// An UploadHandler is an http.Handler that reads a zip archive from the
+// body of POST and PUT requests as it is uploaded, calls Handle for each
+// entry and responds with an UploadSummary in JSON.
+//
+// The archive is read with the request context, so reading stops as soon
+// as the client goes away. Whatever Handle leaves of the content is read
+// to verify the CRC-32 and compute the digests. The response status is 200
+// even if entries failed, and 422 if the archive could not be read to its
+// end, or 413 if it exceeded Limits or MaxBodySize.
+type UploadHandler struct {
+	// Handle is called for each entry. If it is nil, the entries are only
+	// read and summarized.
+	Handle EntryHandler
+
+	// Limits bound what is decompressed.
+	Limits Limits
+
+	// MaxBodySize bounds the size of the request body, if positive.
+	MaxBodySize int64
+
+	// Digests are computed over the content of each entry and reported in
+	// the summary, in hexadecimal.
+	Digests []Digest
+}
+
+// An UploadSummary is the response of an UploadHandler.
+type UploadSummary struct {
+	Entries []UploadEntry `json:"entries"`
+
+	// Error is why the archive could not be read to its end.
+	Error string `json:"error,omitempty"`
+}
+
+// An UploadEntry describes an entry in an UploadSummary.
+type UploadEntry struct {
+	Name           string            `json:"name"`
+	Size           uint64            `json:"size"`
+	CompressedSize uint64            `json:"compressedSize"`
+	CRC32          uint32            `json:"crc32"`
+	Digests        map[string]string `json:"digests,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = req.Body
+	var limited *bodyReader
+	if h.MaxBodySize > 0 {
+		limited = &bodyReader{r: http.MaxBytesReader(w, req.Body, h.MaxBodySize), max: h.MaxBodySize}
+		body = limited
+	}
+
+	ctx := req.Context()
+	summary, err := h.read(ctx, NewReader(body))
+	status := http.StatusOK
+	if err != nil {
+		if ctx.Err() != nil {
+			return // Nobody is listening.
+		}
+		summary.Error = err.Error()
+		status = http.StatusUnprocessableEntity
+		if err == ErrLimit || limited != nil && limited.tooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(summary)
+}
+
+// bodyReader reads a request body through http.MaxBytesReader, whose error
+// it tells from others by the number of bytes read, for that error to have
+// no type of its own before Go 1.19.
+type bodyReader struct {
+	r        io.Reader
+	n, max   int64
+	tooLarge bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF && b.n >= b.max {
+		b.tooLarge = true
+	}
+	return n, err
+}
+
+// read reads the archive of r, calling Handle for each entry.
+func (h *UploadHandler) read(ctx context.Context, r *Reader) (*UploadSummary, error) {
+	r.SetLimits(h.Limits)
+	r.SetDigests(h.Digests...)
+	summary := &UploadSummary{Entries: []UploadEntry{}}
+	for {
+		if _, err := r.NextContext(ctx); err != nil {
+			if err == io.EOF {
+				return summary, nil
+			}
+			return summary, err
+		}
+		e := r.Entry()
+		content := r.ReaderContext(ctx)
+		var herr error
+		if h.Handle != nil {
+			herr = h.Handle(ctx, e, content)
+		}
+		_, err := io.Copy(ioutil.Discard, content)
+		if err != nil && err != zip.ErrChecksum {
+			// The stream cannot be read any further.
+			summary.Entries = append(summary.Entries, uploadEntry(e, err))
+			return summary, err
+		}
+		if err != nil {
+			// Not to be read again by Next.
+			r.closeEntry()
+		}
+		if herr != nil {
+			err = herr
+		}
+		summary.Entries = append(summary.Entries, uploadEntry(e, err))
+	}
+}
+
+func uploadEntry(e *Entry, err error) UploadEntry {
+	u := UploadEntry{
+		Name:           e.Name,
+		Size:           e.UncompressedSize64,
+		CompressedSize: e.CompressedSize64,
+		CRC32:          e.CRC32,
+	}
+	if sums := e.Digests(); len(sums) > 0 {
+		u.Digests = make(map[string]string, len(sums))
+		for name, sum := range sums {
+			u.Digests[name] = hex.EncodeToString(sum)
+		}
+	}
+	if err != nil {
+		u.Error = err.Error()
+	}
+	return u
+}
+
+// An EntryServer is an http.Handler that serves single entries of an
+// archive, such as a documentation bundle kept in object storage, without
+// storing the archive. The path of the request names the entry.
+//
+// The archive is opened for every request and read with ServeEntry, which
+// stops reading once the entry is served.
+type EntryServer struct {
+	// Open opens the archive for a request.
+	Open func(ctx context.Context) (io.ReadCloser, error)
+
+	// Limits bound what is decompressed.
+	Limits Limits
+}
+
+func (s *EntryServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	rc, err := s.Open(req.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+	r := NewReader(rc)
+	r.SetLimits(s.Limits)
+	ServeEntry(w, req, r, name)
+}
+
+// ServeEntry responds to req with the content of the entry of r named name,
+// reading entries until it is found and nothing after it. The entries before
+// it are skipped without being decompressed, and only the entry served is
+// checked against the limits of r. The response is 404 if the archive has no
+// such file.
+//
+// The Content-Type is set from the extension of the name, or sniffed from
+// the content, and Last-Modified from the modification time of the entry,
+// against which If-Modified-Since is checked. If reading the content fails
+// once the response has started, such as when the CRC-32 does not match,
+// the response is aborted with http.ErrAbortHandler so that the client does
+// not take it for complete.
+func ServeEntry(w http.ResponseWriter, req *http.Request, r *Reader, name string) {
+	ctx := req.Context()
+	r.unlimited = func(e *Entry) bool { return e.Name != name || e.Mode().IsDir() }
+	defer func() { r.unlimited = nil }()
+	var f *zip.FileHeader
+	for {
+		var err error
+		f, err = r.NextContext(ctx)
+		if err == nil || err == zip.ErrAlgorithm {
+			if e := r.Entry(); e.Name == name && !e.Mode().IsDir() {
+				if err == nil {
+					break
+				}
+			} else if err == nil {
+				err = r.skipEntry()
+			} else {
+				err = r.skipUnsupported()
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				http.NotFound(w, req)
+			} else if ctx.Err() == nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			}
+			return
+		}
+	}
+
+	h := w.Header()
+	if !f.Modified.IsZero() {
+		if t, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil &&
+			!f.Modified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h.Set("Last-Modified", f.Modified.UTC().Format(http.TimeFormat))
+	}
+
+	content := bufio.NewReaderSize(r.ReaderContext(ctx), 512)
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		b, err := content.Peek(512)
+		if err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		ctype = http.DetectContentType(b)
+	}
+	h.Set("Content-Type", ctype)
+	if !r.Entry().DataDescriptor {
+		h.Set("Content-Length", strconv.FormatUint(f.UncompressedSize64, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
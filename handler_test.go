@@ -0,0 +1,161 @@
+package zipstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func upload(t *testing.T, h http.Handler, z []byte) (int, *UploadSummary) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(z)))
+	var summary UploadSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("%s: %v", w.Body, err)
+	}
+	return w.Code, &summary
+}
+
+func TestUploadHandler(t *testing.T) {
+	z, contents := recoveryZip(t, true)
+	var read [][]byte
+	h := &UploadHandler{
+		Handle: func(ctx context.Context, e *Entry, content io.Reader) error {
+			if e.Name == "b" {
+				return errors.New("rejected")
+			}
+			b, err := ioutil.ReadAll(content)
+			read = append(read, b)
+			return err
+		},
+		Digests: []Digest{SHA256},
+	}
+	code, summary := upload(t, h, z)
+	if code != http.StatusOK || summary.Error != "" || len(summary.Entries) != 3 {
+		t.Fatalf("%d %+v", code, summary)
+	}
+	for i, e := range summary.Entries {
+		if e.Size != uint64(len(contents[i])) || len(e.Digests["sha256"]) != 64 {
+			t.Errorf("%+v", e)
+		}
+	}
+	if summary.Entries[1].Error != "rejected" || summary.Entries[0].Error != "" {
+		t.Errorf("errors %q, %q", summary.Entries[0].Error, summary.Entries[1].Error)
+	}
+	if len(read) != 2 || !bytes.Equal(read[1], contents[2]) {
+		t.Errorf("handled %d entries", len(read))
+	}
+
+	// Damaged and oversized archives
+	code, summary = upload(t, h, z[:len(z)/2])
+	if code != http.StatusUnprocessableEntity || summary.Error == "" {
+		t.Errorf("truncated archive: %d %+v", code, summary)
+	}
+	h.Limits = Limits{MaxTotalSize: 1000}
+	if code, _ = upload(t, h, z); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("archive over the limits: %d", code)
+	}
+	h.Limits = Limits{}
+	h.MaxBodySize = int64(len(z)) / 2
+	if code, _ = upload(t, h, z); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit: %d", code)
+	}
+}
+
+// countingReadCloser counts the bytes read of an archive.
+type countingReadCloser struct {
+	io.Reader
+	n      int64
+	closed bool
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReadCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEntryServer(t *testing.T) {
+	modified := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	notes := deflated("notes", strings.Repeat("note ", 100))
+	notes.sized = true // with its size declared in its header
+	entries := []testEntry{notes}
+	for _, name := range []string{"docs/index.html", "docs/data", "big"} {
+		e := deflated(name, "<html>"+name)
+		e.h.Modified = modified
+		if name == "big" {
+			b := make([]byte, 1<<20)
+			rand.New(rand.NewSource(1)).Read(b)
+			e.content = string(b)
+		}
+		entries = append(entries, e)
+	}
+	z := testZip(t, "", entries...)
+
+	var src *countingReadCloser
+	s := &EntryServer{Open: func(context.Context) (io.ReadCloser, error) {
+		src = &countingReadCloser{Reader: bytes.NewReader(z)}
+		return src, nil
+	}}
+	get := func(name string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, name, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, test := range []struct {
+		name, ctype string
+	}{
+		{"/docs/index.html", "text/html; charset=utf-8"},
+		{"/docs/data", "text/html; charset=utf-8"}, // Sniffed
+	} {
+		w := get(test.name, nil)
+		if w.Code != http.StatusOK || w.Body.String() != "<html>"+test.name[1:] {
+			t.Errorf("%s: %d %q", test.name, w.Code, w.Body)
+		}
+		if ctype := w.Header().Get("Content-Type"); ctype != test.ctype {
+			t.Errorf("%s: Content-Type %q, want %q", test.name, ctype, test.ctype)
+		}
+		if lm := w.Header().Get("Last-Modified"); lm != modified.Format(http.TimeFormat) {
+			t.Errorf("%s: Last-Modified %q", test.name, lm)
+		}
+		if src.n == int64(len(z)) || !src.closed {
+			t.Errorf("%s: read %d bytes of %d, closed %v", test.name, src.n, len(z), src.closed)
+		}
+	}
+
+	if w := get("/docs/index.html", http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}}); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: %d", w.Code)
+	}
+	if w := get("/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing entry: %d", w.Code)
+	}
+
+	// The entries before the one served do not count against the limits,
+	// not even their declared sizes.
+	s.Limits = Limits{MaxEntries: 1, MaxEntrySize: 20, MaxTotalSize: 20}
+	if w := get("/docs/data", nil); w.Code != http.StatusOK {
+		t.Errorf("limited: %d %q", w.Code, w.Body)
+	}
+	if w := get("/big", nil); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("limited big entry: %d", w.Code)
+	}
+}
@@ -0,0 +1,369 @@
+package zipstream
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// httpBlockSize is the unit in which ranges are requested and cached.
+	httpBlockSize = 64 << 10
+
+	// httpCacheBlocks is the number of blocks cached by default.
+	httpCacheBlocks = 256
+
+	// httpReadAhead is the number of blocks requested past a read that
+	// follows the previous one.
+	httpReadAhead = 16
+
+	// httpRetries is the number of times a failed request is retried by
+	// default.
+	httpRetries = 3
+)
+
+var (
+	// ErrRangeUnsupported is returned by an HTTPReaderAt when the server
+	// answers a Range request with the whole resource.
+	ErrRangeUnsupported = errors.New("zipstream: server does not support range requests")
+
+	// ErrRemoteChanged is returned by an HTTPReaderAt when the resource
+	// changed since it was opened.
+	ErrRemoteChanged = errors.New("zipstream: remote resource changed")
+)
+
+// An HTTPReaderAt reads a resource served over HTTP with Range requests, so
+// that an archive can be read with NewSeekableReader without downloading
+// all of it:
+//
+//	h, err := zipstream.NewHTTPReaderAt(ctx, http.DefaultClient, url)
+//	...
+//	r, err := zipstream.NewSeekableReader(h, h.Size())
+//
+// Ranges are requested in blocks of 64 KiB, which are cached. The blocks
+// missing for a read are requested together, reads that follow each other
+// request the next blocks ahead, and concurrent reads of the same blocks
+// share the requests. Requests that fail with a network error or a server
+// error are retried.
+//
+// It is safe for concurrent use.
+type HTTPReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+	etag   string
+
+	retries int
+	backoff time.Duration
+
+	mu        sync.Mutex
+	cache     map[int64]*list.Element // of *httpBlock, by index
+	lru       *list.List
+	maxBlocks int
+	pending   map[int64]*httpFetch
+}
+
+type httpBlock struct {
+	index int64
+	data  []byte
+}
+
+// httpFetch is a block being requested, which readers needing it wait for.
+type httpFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// httpStatusError is a response with an unexpected status.
+type httpStatusError struct {
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("zipstream: unexpected HTTP status %d %s", e.status, http.StatusText(e.status))
+}
+
+// NewHTTPReaderAt creates an HTTPReaderAt of the resource at url, requested
+// with client and ctx. The first block is requested at once, to find the
+// size of the resource and check that the server supports Range requests.
+func NewHTTPReaderAt(ctx context.Context, client *http.Client, url string) (*HTTPReaderAt, error) {
+	h := &HTTPReaderAt{
+		ctx:       ctx,
+		client:    client,
+		url:       url,
+		retries:   httpRetries,
+		backoff:   100 * time.Millisecond,
+		cache:     make(map[int64]*list.Element),
+		lru:       list.New(),
+		maxBlocks: httpCacheBlocks,
+		pending:   make(map[int64]*httpFetch),
+	}
+	h.size = -1
+	data, err := h.fetch(0, httpBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		h.add(0, data)
+	}
+	return h, nil
+}
+
+// Size returns the size of the resource.
+func (h *HTTPReaderAt) Size() int64 { return h.size }
+
+// SetCacheSize sets the number of 64 KiB blocks kept in the cache, 256 by
+// default.
+func (h *HTTPReaderAt) SetCacheSize(blocks int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxBlocks = blocks
+	h.evict()
+}
+
+// SetRetries sets the number of times a failed request is retried, 3 by
+// default. It is not safe to call concurrently with ReadAt.
+func (h *HTTPReaderAt) SetRetries(n int) {
+	h.retries = n
+}
+
+// ReadAt implements io.ReaderAt.
+func (h *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("zipstream: negative offset")
+	}
+	if off >= h.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > h.size {
+		end = h.size
+	}
+	if end == off {
+		return 0, nil
+	}
+	first, last := off/httpBlockSize, (end-1)/httpBlockSize
+	blocks, err := h.blocks(first, last)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, blocks[0][off-first*httpBlockSize:])
+	for _, b := range blocks[1:] {
+		n += copy(p[n:], b)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// blocks returns the blocks first to last, requesting those that are
+// neither cached nor being requested already.
+func (h *HTTPReaderAt) blocks(first, last int64) ([][]byte, error) {
+	blocks := make([][]byte, last-first+1)
+	waits := make([]*httpFetch, len(blocks))
+	var runs [][2]int64 // of blocks to request, inclusive
+
+	h.mu.Lock()
+	for i := first; i <= last; i++ {
+		if el, ok := h.cache[i]; ok {
+			h.lru.MoveToFront(el)
+			blocks[i-first] = el.Value.(*httpBlock).data
+			continue
+		}
+		f, ok := h.pending[i]
+		if !ok {
+			f = h.start(i)
+			if n := len(runs); n > 0 && runs[n-1][1] == i-1 {
+				runs[n-1][1] = i
+			} else {
+				runs = append(runs, [2]int64{i, i})
+			}
+		}
+		waits[i-first] = f
+	}
+	// A read following the previous one is likely followed by more.
+	if n := len(runs); n > 0 && runs[n-1][1] == last && h.cache[first-1] != nil {
+		blocks := (h.size + httpBlockSize - 1) / httpBlockSize
+		for i := last + 1; i < blocks && i <= last+httpReadAhead; i++ {
+			if h.cache[i] != nil || h.pending[i] != nil {
+				break
+			}
+			h.start(i)
+			runs[n-1][1] = i
+		}
+	}
+	h.mu.Unlock()
+
+	for _, run := range runs {
+		start, end := run[0]*httpBlockSize, (run[1]+1)*httpBlockSize
+		if end > h.size {
+			end = h.size
+		}
+		data, err := h.fetch(start, end)
+		h.mu.Lock()
+		for i := run[0]; i <= run[1]; i++ {
+			f := h.pending[i]
+			delete(h.pending, i)
+			if err != nil {
+				f.err = err
+			} else {
+				lo := (i - run[0]) * httpBlockSize
+				hi := lo + httpBlockSize
+				if hi > int64(len(data)) {
+					hi = int64(len(data))
+				}
+				f.data = data[lo:hi]
+				h.add(i, f.data)
+			}
+			close(f.done)
+		}
+		h.mu.Unlock()
+	}
+
+	for i, f := range waits {
+		if f == nil {
+			continue
+		}
+		<-f.done
+		if f.err != nil {
+			return nil, f.err
+		}
+		blocks[i] = f.data
+	}
+	return blocks, nil
+}
+
+// start registers the request of block i.
+func (h *HTTPReaderAt) start(i int64) *httpFetch {
+	f := &httpFetch{done: make(chan struct{})}
+	h.pending[i] = f
+	return f
+}
+
+// add caches block i, evicting the least recently used blocks.
+func (h *HTTPReaderAt) add(i int64, data []byte) {
+	h.cache[i] = h.lru.PushFront(&httpBlock{index: i, data: data})
+	h.evict()
+}
+
+func (h *HTTPReaderAt) evict() {
+	for h.lru.Len() > h.maxBlocks {
+		el := h.lru.Back()
+		h.lru.Remove(el)
+		delete(h.cache, el.Value.(*httpBlock).index)
+	}
+}
+
+// fetch requests the bytes from start to end, retrying on failures that may
+// be transient.
+func (h *HTTPReaderAt) fetch(start, end int64) ([]byte, error) {
+	backoff := h.backoff
+	for attempt := 0; ; attempt++ {
+		data, err := h.get(start, end)
+		if err == nil || attempt >= h.retries || !retryable(err) || h.ctx.Err() != nil {
+			return data, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-h.ctx.Done():
+			return nil, h.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// get requests the bytes from start to end once. Until the size is known,
+// it also sets the size and the entity tag of the resource.
+func (h *HTTPReaderAt) get(start, end int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if h.etag != "" && !strings.HasPrefix(h.etag, "W/") {
+		// A weak tag never matches, If-Match comparing tags strongly.
+		req.Header.Set("If-Match", h.etag)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, ErrRangeUnsupported
+	case http.StatusPreconditionFailed:
+		return nil, ErrRemoteChanged
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Only an empty resource has no first block.
+		if h.size < 0 && contentRangeSize(resp.Header.Get("Content-Range")) == 0 {
+			h.size = 0
+			return nil, nil
+		}
+		return nil, &httpStatusError{resp.StatusCode}
+	default:
+		return nil, &httpStatusError{resp.StatusCode}
+	}
+
+	size := contentRangeSize(resp.Header.Get("Content-Range"))
+	if h.size < 0 {
+		if size < 0 {
+			return nil, ErrRangeUnsupported
+		}
+		h.size = size
+		h.etag = resp.Header.Get("ETag")
+		if end > size {
+			end = size
+		}
+	} else if size != h.size || resp.Header.Get("ETag") != h.etag {
+		return nil, ErrRemoteChanged
+	}
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// contentRangeSize returns the complete length given by a Content-Range
+// header, or -1 if it gives none.
+func contentRangeSize(s string) int64 {
+	i := strings.LastIndexByte(s, '/')
+	if !strings.HasPrefix(s, "bytes ") || i < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// made again.
+func retryable(err error) bool {
+	switch err {
+	case ErrRangeUnsupported, ErrRemoteChanged, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return se.status >= 500 || se.status == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package zipstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// rangeServer serves content with Range requests, counting the requests and
+// the bytes served. The first failures requests fail.
+type rangeServer struct {
+	content  []byte
+	etag     string
+	failures int32
+	requests int32
+	served   int64
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	cw := &countingWriter{ResponseWriter: w, n: &s.served}
+	http.ServeContent(cw, req, "", time.Time{}, bytes.NewReader(s.content))
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func newHTTPReaderAt(t *testing.T, s *rangeServer) (*HTTPReaderAt, *httptest.Server) {
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	h, err := NewHTTPReaderAt(context.Background(), ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.backoff = time.Millisecond
+	return h, ts
+}
+
+// bigZip returns an archive of incompressible entries, the one named
+// "small" in the middle.
+func bigZip(t *testing.T) []byte {
+	big := make([]byte, 2<<20)
+	for i := range big {
+		big[i] = byte(i * 7919 >> 3)
+	}
+	var entries []testEntry
+	for _, name := range []string{"big1", "small", "big2"} {
+		content := name
+		if name != "small" {
+			content = string(big)
+		}
+		entries = append(entries, testEntry{h: zip.FileHeader{Name: name, Method: Store}, content: content, sized: true})
+	}
+	return testZip(t, "", entries...)
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	z := bigZip(t)
+	s := &rangeServer{content: z, etag: `"1"`}
+	h, _ := newHTTPReaderAt(t, s)
+	if h.Size() != int64(len(z)) {
+		t.Fatalf("size %d, want %d", h.Size(), len(z))
+	}
+
+	r, err := NewSeekableReader(h, h.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		f, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name != "small" {
+			continue
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil || string(b) != "small" {
+			t.Fatalf("read %q, %v", b, err)
+		}
+		break
+	}
+	if served := atomic.LoadInt64(&s.served); served > int64(len(z))/4 {
+		t.Errorf("served %d bytes of %d to read a small entry", served, len(z))
+	}
+
+	// Sequential reads are coalesced and read ahead.
+	requests := atomic.LoadInt32(&s.requests)
+	b, err := ioutil.ReadAll(io.NewSectionReader(h, 0, h.Size()))
+	if err != nil || !bytes.Equal(b, z) {
+		t.Fatalf("read %d bytes, %v", len(b), err)
+	}
+	if n := atomic.LoadInt32(&s.requests) - requests; n > int32(len(z)/httpBlockSize/httpReadAhead)+4 {
+		t.Errorf("%d requests to read %d bytes", n, len(z))
+	}
+}
+
+func TestHTTPReaderAtConcurrent(t *testing.T) {
+	z := bigZip(t)
+	s := &rangeServer{content: z, etag: `"1"`}
+	h, _ := newHTTPReaderAt(t, s)
+	requests := atomic.LoadInt32(&s.requests)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 3*httpBlockSize)
+			if _, err := h.ReadAt(p, 10*httpBlockSize); err != nil || !bytes.Equal(p, z[10*httpBlockSize:13*httpBlockSize]) {
+				t.Errorf("ReadAt: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	// Readers arriving while blocks are requested wait for them, so each
+	// block is requested once.
+	if n := atomic.LoadInt32(&s.requests) - requests; n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestHTTPReaderAtRetry(t *testing.T) {
+	z := bigZip(t)
+	s := &rangeServer{content: z, etag: `"1"`, failures: 2}
+	h, _ := newHTTPReaderAt(t, s)
+	p := make([]byte, 100)
+	if _, err := h.ReadAt(p, int64(len(z))-100); err != nil || !bytes.Equal(p, z[len(z)-100:]) {
+		t.Fatalf("ReadAt: %v", err)
+	}
+
+	atomic.StoreInt32(&s.failures, 10)
+	if _, err := h.ReadAt(p, int64(len(z))/2); err == nil {
+		t.Error("ReadAt succeeded with the server failing")
+	}
+	if n := atomic.LoadInt32(&s.failures); n != 10-int32(httpRetries)-1 {
+		t.Errorf("%d requests, want %d", 10-n, httpRetries+1)
+	}
+}
+
+func TestHTTPReaderAtErrors(t *testing.T) {
+	z := bigZip(t)
+	for _, etag := range []string{`"1"`, `W/"1"`} {
+		s := &rangeServer{content: z, etag: etag}
+		h, _ := newHTTPReaderAt(t, s)
+		if _, err := h.ReadAt(make([]byte, 10), int64(len(z))/2); err != nil {
+			t.Errorf("ETag %s: ReadAt = %v", etag, err)
+		}
+		s.etag = etag[:len(etag)-2] + `2"`
+		if _, err := h.ReadAt(make([]byte, 10), int64(len(z))/4); err != ErrRemoteChanged {
+			t.Errorf("ETag %s: ReadAt = %v, want %v", etag, err, ErrRemoteChanged)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(z)
+	}))
+	defer ts.Close()
+	if _, err := NewHTTPReaderAt(context.Background(), ts.Client(), ts.URL); err != ErrRangeUnsupported {
+		t.Errorf("NewHTTPReaderAt = %v, want %v", err, ErrRangeUnsupported)
+	}
+}
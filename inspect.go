@@ -0,0 +1,355 @@
+package zipstream
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// An Anomaly is a kind of structural oddity found in an archive by Inspect.
+type Anomaly string
+
+const (
+	LeadingJunk        Anomaly = "leading-junk"        // data before the first entry
+	Junk               Anomaly = "junk"                // data between entries
+	TrailingJunk       Anomaly = "trailing-junk"       // data after the end of central directory record
+	DuplicateName      Anomaly = "duplicate-name"      // an entry named as an earlier one
+	Overlap            Anomaly = "overlap"             // directory records sharing an entry, or pointing inside one
+	MissingEntry       Anomaly = "missing-entry"       // a directory record without a local file header
+	UnlistedEntry      Anomaly = "unlisted-entry"      // a local file header without a directory record
+	Mismatch           Anomaly = "mismatch"            // a local file header differing from its directory record
+	UnusualFlags       Anomaly = "unusual-flags"       // encryption, reserved or inconsistent flags
+	UnsupportedMethod  Anomaly = "unsupported-method"  // a compression method without a Decompressor
+	UnsignedDescriptor Anomaly = "unsigned-descriptor" // a data descriptor without its optional signature
+	UnneededZip64      Anomaly = "unneeded-zip64"      // zip64 fields for sizes that fit in 32 bits
+	SuspiciousRatio    Anomaly = "suspicious-ratio"    // content decompressing to over 100 times its size
+	Timestamp          Anomaly = "timestamp"           // invalid, inconsistent or future modification times
+	ChecksumMismatch   Anomaly = "checksum-mismatch"   // content not matching its CRC-32
+)
+
+// maxRatio is the compression ratio above which Inspect reports entries
+// larger than minRatioSize.
+const maxRatio = 100
+
+// A Finding is an anomaly found at some position in the stream.
+type Finding struct {
+	Anomaly Anomaly
+	Offset  int64  // in the stream
+	Name    string // of the entry, if any
+	Detail  string
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%d: %s", f.Offset, f.Anomaly)
+	if f.Name != "" {
+		s += " " + strconv.Quote(f.Name)
+	}
+	if f.Detail != "" {
+		s += ": " + f.Detail
+	}
+	return s
+}
+
+// A Report is the outcome of Inspect.
+type Report struct {
+	// Entries is the number of local file headers read.
+	Entries int
+
+	// Size is the number of bytes read from the stream.
+	Size int64
+
+	// Directory is the central directory, if it was reached.
+	Directory *Directory
+
+	// Findings are the anomalies found, in stream order except for those
+	// found in the central directory, which follow the entries.
+	Findings []Finding
+}
+
+// Inspect reads the archive of r to the end of the stream, reading every
+// entry to verify it, and reports structural anomalies. Entries are only
+// decompressed until their ratio becomes suspicious, so that zip bombs are
+// reported rather than decompressed. Most of them are
+// harmless but tell of unusual writers, or of archives crafted to be read
+// differently by different readers.
+//
+// An error is returned, along with what was found so far, if the stream
+// could not be read to the end of the archive.
+func Inspect(r io.Reader) (*Report, error) {
+	in := &inspector{
+		r:      NewReader(r),
+		report: new(Report),
+		names:  make(map[string]bool),
+		local:  make(map[int64]*Entry),
+	}
+	in.r.SetObserver(in)
+	in.r.SetLimits(Limits{MaxRatio: maxRatio})
+	err := in.run()
+	in.report.Size = in.r.src.n
+	return in.report, err
+}
+
+// inspector observes a Reader to report junk between entries.
+type inspector struct {
+	NopObserver
+	r       *Reader
+	report  *Report
+	names   map[string]bool
+	entries []*Entry
+	local   map[int64]*Entry // by HeaderOffset
+}
+
+func (in *inspector) add(a Anomaly, e *Entry, offset int64, format string, args ...interface{}) {
+	f := Finding{Anomaly: a, Offset: offset, Detail: fmt.Sprintf(format, args...)}
+	if e != nil {
+		f.Name = e.Name
+	}
+	in.report.Findings = append(in.report.Findings, f)
+}
+
+func (in *inspector) JunkSkipped(n int64) {
+	a := Junk
+	if len(in.entries) == 0 {
+		a = LeadingJunk
+	}
+	in.add(a, nil, in.r.offset()-n, "%d bytes", n)
+}
+
+func (in *inspector) run() error {
+	r := in.r
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != zip.ErrAlgorithm && err != ErrLimit {
+			return err
+		}
+		e := r.entry
+		in.report.Entries++
+		in.entries = append(in.entries, e)
+		in.local[e.HeaderOffset] = e
+		in.header(e)
+
+		suspicious := false
+		switch {
+		case err == zip.ErrAlgorithm:
+			in.add(UnsupportedMethod, e, e.HeaderOffset, "method %d", e.Method)
+			if err := r.skipUnsupported(); err != nil {
+				return err
+			}
+		case err == ErrLimit:
+			// From the sizes of the header, without decompressing
+			// anything.
+			suspicious = true
+			in.add(SuspiciousRatio, e, e.DataOffset, "%d bytes from %d", e.UncompressedSize64, e.CompressedSize64)
+			if err := r.skipUnsupported(); err != nil {
+				return err
+			}
+		case e.Flags&0x1 != 0:
+			// Encrypted content cannot be verified.
+			if err := r.skipEntry(); err != nil {
+				return err
+			}
+		default:
+			_, err := io.Copy(ioutil.Discard, r)
+			switch err {
+			case nil:
+			case zip.ErrChecksum:
+				in.add(ChecksumMismatch, e, e.DataOffset, "")
+				r.closeEntry()
+			case ErrLimit:
+				suspicious = true
+				p := r.progress
+				in.add(SuspiciousRatio, e, e.DataOffset, "over %d bytes from %d", p.uncompressed, p.compressed)
+				if err := r.skipEntry(); err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+		}
+		in.content(e, suspicious)
+	}
+
+	if !r.ended {
+		// The stream ended without a central directory.
+		if len(in.entries) == 0 {
+			return zip.ErrFormat
+		}
+		return io.ErrUnexpectedEOF
+	}
+	in.report.Directory = r.directory
+	in.directory(r.directory)
+	n, err := io.Copy(ioutil.Discard, r.Buffered())
+	if n > 0 {
+		in.add(TrailingJunk, nil, r.src.n-n, "%d bytes", n)
+	}
+	return err
+}
+
+// header checks the local file header of e.
+func (in *inspector) header(e *Entry) {
+	if in.names[e.Name] {
+		in.add(DuplicateName, e, e.HeaderOffset, "")
+	}
+	in.names[e.Name] = true
+
+	var flags []string
+	if e.Flags&0x1 != 0 {
+		flags = append(flags, "encrypted")
+	}
+	if e.Flags&0x40 != 0 {
+		flags = append(flags, "strong encryption")
+	}
+	if e.Flags&0x2000 != 0 {
+		flags = append(flags, "masked local header")
+	}
+	if reserved := e.Flags & 0xd780; reserved != 0 {
+		flags = append(flags, fmt.Sprintf("reserved bits %#04x", reserved))
+	}
+	if e.Flags&0x800 != 0 && !utf8.Valid(e.RawName) {
+		flags = append(flags, "UTF-8 flag on a name that is not UTF-8")
+	}
+	if len(flags) > 0 {
+		in.add(UnusualFlags, e, e.HeaderOffset, "%s", strings.Join(flags, ", "))
+	}
+
+	if hasExtra(e.Extra, zip64ExtraID) && e.CompressedSize != ^uint32(0) && e.UncompressedSize != ^uint32(0) {
+		in.add(UnneededZip64, e, e.HeaderOffset, "zip64 extra field with 32-bit sizes")
+	}
+
+	in.timestamp(e)
+}
+
+// timestamp checks the modification times of e.
+func (in *inspector) timestamp(e *Entry) {
+	date, tm := e.ModifiedDate, e.ModifiedTime
+	dos := msDosTimeToTime(date, tm)
+	if date == 0 && tm == 0 {
+		in.add(Timestamp, e, e.HeaderOffset, "no MS-DOS time")
+	} else if month, day := int(date>>5&0xf), int(date&0x1f); month < 1 || month > 12 || day < 1 ||
+		dos.Day() != day || tm>>11 > 23 || tm>>5&0x3f > 59 || tm&0x1f > 29 {
+		in.add(Timestamp, e, e.HeaderOffset, "invalid MS-DOS time %#04x %#04x", date, tm)
+	}
+
+	if ext := e.Extras.Modified; !ext.IsZero() {
+		// The MS-DOS time is local, so it differs from the extended one
+		// by the offset of a time zone, to within its 2s resolution.
+		delta := dos.Sub(ext)
+		if rem := delta % (15 * time.Minute); date != 0 &&
+			(delta > 14*time.Hour+2*time.Second || delta < -14*time.Hour-2*time.Second ||
+				rem > 2*time.Second && rem < 15*time.Minute-2*time.Second ||
+				rem < -2*time.Second && rem > -15*time.Minute+2*time.Second) {
+			in.add(Timestamp, e, e.HeaderOffset, "MS-DOS time %s from extended time", delta)
+		}
+	}
+	if e.Modified.After(time.Now().Add(24 * time.Hour)) {
+		in.add(Timestamp, e, e.HeaderOffset, "in the future: %s", e.Modified.Format(time.RFC3339))
+	}
+}
+
+// content checks e once its content has been read, unless its ratio was
+// found suspicious already.
+func (in *inspector) content(e *Entry, suspicious bool) {
+	if d := e.descriptor; d != nil {
+		if !d.signature {
+			in.add(UnsignedDescriptor, e, e.DataOffset+int64(e.CompressedSize64), "")
+		}
+		if d.zip64 && e.CompressedSize64 < 0xffffffff && e.UncompressedSize64 < 0xffffffff {
+			in.add(UnneededZip64, e, e.DataOffset+int64(e.CompressedSize64), "zip64 data descriptor")
+		}
+	}
+	if c, u := e.CompressedSize64, e.UncompressedSize64; !suspicious && u > minRatioSize && u > maxRatio*c {
+		in.add(SuspiciousRatio, e, e.DataOffset, "%d bytes from %d", u, c)
+	}
+}
+
+// directory checks the central directory against the local file headers.
+func (in *inspector) directory(d *Directory) {
+	listed := make(map[int64]bool)
+	for i, f := range d.Files {
+		offset := d.offsets[i]
+		e := in.local[offset]
+		if e == nil {
+			if owner := in.within(offset); owner != nil {
+				in.add(Overlap, owner, d.Offset, "%q points inside it at %d", f.Name, offset)
+			} else {
+				in.add(MissingEntry, nil, d.Offset, "%q at %d", f.Name, offset)
+			}
+			continue
+		}
+		if listed[offset] {
+			in.add(Overlap, e, d.Offset, "listed again as %q", f.Name)
+			continue
+		}
+		listed[offset] = true
+		if diff := headerDiff(e.FileHeader, f); len(diff) > 0 {
+			in.add(Mismatch, e, d.Offset, "%s", strings.Join(diff, ", "))
+		}
+	}
+	for _, e := range in.entries {
+		if !listed[e.HeaderOffset] {
+			in.add(UnlistedEntry, e, e.HeaderOffset, "")
+		}
+	}
+}
+
+// within returns the entry whose header or content spans offset.
+func (in *inspector) within(offset int64) *Entry {
+	for _, e := range in.entries {
+		if offset > e.HeaderOffset && offset < e.DataOffset+int64(e.CompressedSize64) {
+			return e
+		}
+	}
+	return nil
+}
+
+// headerDiff lists the fields in which a local file header and its
+// directory record differ.
+func headerDiff(local, central *zip.FileHeader) []string {
+	var diff []string
+	if local.Name != central.Name {
+		diff = append(diff, fmt.Sprintf("name %q", central.Name))
+	}
+	if local.Method != central.Method {
+		diff = append(diff, fmt.Sprintf("method %d, %d", local.Method, central.Method))
+	}
+	if local.Flags != central.Flags {
+		diff = append(diff, fmt.Sprintf("flags %#04x, %#04x", local.Flags, central.Flags))
+	}
+	if local.CRC32 != central.CRC32 {
+		diff = append(diff, fmt.Sprintf("CRC-32 %#08x, %#08x", local.CRC32, central.CRC32))
+	}
+	if local.CompressedSize64 != central.CompressedSize64 {
+		diff = append(diff, fmt.Sprintf("compressed size %d, %d", local.CompressedSize64, central.CompressedSize64))
+	}
+	if local.UncompressedSize64 != central.UncompressedSize64 {
+		diff = append(diff, fmt.Sprintf("size %d, %d", local.UncompressedSize64, central.UncompressedSize64))
+	}
+	if local.ModifiedDate != central.ModifiedDate || local.ModifiedTime != central.ModifiedTime {
+		diff = append(diff, "MS-DOS time")
+	}
+	return diff
+}
+
+// hasExtra reports whether extra holds a field with the given ID.
+func hasExtra(extra []byte, id uint16) bool {
+	for b := readBuf(extra); len(b) >= 4; {
+		tag, size := b.uint16(), int(b.uint16())
+		if tag == id {
+			return true
+		}
+		if len(b) < size {
+			return false
+		}
+		b.sub(size)
+	}
+	return false
+}
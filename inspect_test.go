@@ -0,0 +1,130 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// anomalies returns the anomalies of a report, with how many times they
+// were found.
+func anomalies(r *Report) map[Anomaly]int {
+	m := make(map[Anomaly]int)
+	for _, f := range r.Findings {
+		m[f.Anomaly]++
+	}
+	return m
+}
+
+func TestInspectTestdata(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want map[Anomaly]int
+	}{
+		{"test.zip", map[Anomaly]int{}},
+		{"winxp.zip", map[Anomaly]int{}},
+		{"time-infozip.zip", map[Anomaly]int{}},
+		{"test-trailing-junk.zip", map[Anomaly]int{TrailingJunk: 1}},
+		{"readme.notzip", map[Anomaly]int{LeadingJunk: 1, TrailingJunk: 1}},
+		{"go-no-datadesc-sig.zip.base64", map[Anomaly]int{UnsignedDescriptor: 2}},
+		{"go-with-datadesc-sig.zip", map[Anomaly]int{Timestamp: 2}},
+	} {
+		z, err := ioutil.ReadFile(filepath.Join("testdata", test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Ext(test.name) == ".base64" {
+			if z, err = base64.StdEncoding.DecodeString(string(z)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := Inspect(bytes.NewReader(z))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := anomalies(r)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: %v, want %v", test.name, r.Findings, test.want)
+			continue
+		}
+		for a, n := range test.want {
+			if got[a] != n {
+				t.Errorf("%s: %v, want %v", test.name, r.Findings, test.want)
+			}
+		}
+	}
+
+	png, err := ioutil.ReadFile("testdata/gophercolor16x16.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inspect(bytes.NewReader(png)); err != zip.ErrFormat {
+		t.Errorf("Inspect of a PNG = %v, want %v", err, zip.ErrFormat)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("junk")
+	zw := zip.NewWriter(&buf)
+	createSized(t, zw, "a", Deflate, make([]byte, 2<<20))
+	createSized(t, zw, "a", Store, []byte("stored"))
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "m", Method: 77, CompressedSize64: 5, UncompressedSize64: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("77777"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("tail")
+	z := buf.Bytes()
+
+	z[bytes.Index(z, []byte("stored"))] ^= 1
+	dir := bytes.LastIndex(z, []byte{0x50, 0x4b, 0x01, 0x02}) // of "m"
+	binary.LittleEndian.PutUint32(z[dir+16:], 0x12345678)
+
+	r, err := Inspect(bytes.NewReader(z))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := anomalies(r)
+	for _, a := range []Anomaly{LeadingJunk, SuspiciousRatio, DuplicateName, ChecksumMismatch,
+		UnsupportedMethod, Mismatch, TrailingJunk} {
+		if got[a] != 1 {
+			t.Errorf("%s found %d times in %v", a, got[a], r.Findings)
+		}
+	}
+	if r.Entries != 3 || r.Size != int64(len(z)) || r.Directory == nil {
+		t.Errorf("report of %d entries, %d bytes", r.Entries, r.Size)
+	}
+}
+
+func TestInspectBomb(t *testing.T) {
+	// With its sizes in a data descriptor, so known once it is read only.
+	z := testZip(t, "", deflated("bomb", string(make([]byte, 64<<20))), deflated("after", "after"))
+	r, err := Inspect(bytes.NewReader(z))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []Finding
+	for _, f := range r.Findings {
+		if f.Anomaly == SuspiciousRatio {
+			found = append(found, f)
+		}
+	}
+	if len(found) != 1 || r.Entries != 2 {
+		t.Fatalf("%d entries, findings %v", r.Entries, r.Findings)
+	}
+	var n int64
+	if _, err := fmt.Sscanf(found[0].Detail, "over %d bytes", &n); err != nil || n > 2*minRatioSize {
+		t.Errorf("decompressed %q", found[0].Detail)
+	}
+}
@@ -0,0 +1,440 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// manifestName is the name of the manifest of a JAR.
+	manifestName = "META-INF/MANIFEST.MF"
+
+	// maxJarMetaSize bounds the size of the manifest and signature files
+	// read into memory.
+	maxJarMetaSize = 16 << 20
+)
+
+// ErrManifest is returned when a manifest or signature file of a JAR is
+// malformed.
+var ErrManifest = errors.New("zipstream: malformed JAR manifest")
+
+// jarDigests are the digests of the manifest format, by the name of their
+// algorithm in "<algorithm>-Digest" attributes.
+var jarDigests = map[string]Digest{
+	"SHA-256": SHA256,
+	"SHA-384": SHA384,
+	"SHA-512": SHA512,
+	"SHA1":    SHA1,
+	"SHA-1":   SHA1,
+	"MD5":     MD5,
+}
+
+// Attributes are the attributes of a section of a manifest, by name.
+type Attributes map[string]string
+
+// A Manifest is a JAR manifest, or a signature file which has the same
+// format.
+type Manifest struct {
+	// Main are the main attributes.
+	Main Attributes
+
+	// Entries are the attributes of the per-entry sections, by the name
+	// of their entry.
+	Entries map[string]Attributes
+
+	raw      []byte
+	mainRaw  []byte            // bytes of the main section
+	sections map[string][]byte // bytes of every per-entry section
+}
+
+// ParseManifest parses a manifest or a signature file.
+func ParseManifest(b []byte) (*Manifest, error) {
+	m := &Manifest{
+		Entries:  make(map[string]Attributes),
+		raw:      b,
+		sections: make(map[string][]byte),
+	}
+	for len(b) > 0 {
+		attrs, n, err := parseSection(b)
+		if err != nil {
+			return nil, err
+		}
+		raw := b[:n]
+		b = b[n:]
+		switch {
+		case m.Main == nil:
+			m.Main, m.mainRaw = attrs, raw
+		case len(attrs) == 0:
+			// Blank lines between sections
+		case attrs["Name"] == "":
+			return nil, ErrManifest
+		default:
+			m.Entries[attrs["Name"]] = attrs
+			m.sections[attrs["Name"]] = raw
+		}
+	}
+	if m.Main == nil {
+		m.Main = Attributes{}
+	}
+	return m, nil
+}
+
+// parseSection parses the section at the start of b, returning its
+// attributes and its length up to and including the blank line ending it.
+func parseSection(b []byte) (Attributes, int, error) {
+	attrs := Attributes{}
+	var key string
+	n := 0
+	for n < len(b) {
+		line, next := manifestLine(b[n:])
+		n += next
+		switch {
+		case len(line) == 0:
+			return attrs, n, nil
+		case line[0] == ' ':
+			// Continuation of the previous value
+			if key == "" {
+				return nil, 0, ErrManifest
+			}
+			attrs[key] += string(line[1:])
+		default:
+			i := bytes.Index(line, []byte(": "))
+			if i <= 0 {
+				return nil, 0, ErrManifest
+			}
+			key = string(line[:i])
+			attrs[key] = string(line[i+2:])
+		}
+	}
+	return attrs, n, nil
+}
+
+// manifestLine returns the line at the start of b, without its end, and
+// the length of the line with its end.
+func manifestLine(b []byte) ([]byte, int) {
+	i := bytes.IndexAny(b, "\r\n")
+	switch {
+	case i < 0:
+		return b, len(b)
+	case b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n':
+		return b[:i], i + 2
+	default:
+		return b[:i], i + 1
+	}
+}
+
+// MainClass returns the Main-Class attribute.
+func (m *Manifest) MainClass() string {
+	return m.Main["Main-Class"]
+}
+
+// ClassPath returns the relative URLs of the Class-Path attribute.
+func (m *Manifest) ClassPath() []string {
+	return strings.Fields(m.Main["Class-Path"])
+}
+
+// A JarSignature is a signature of a JAR: a signature file, META-INF/*.SF,
+// and the signature block signing it, such as META-INF/*.RSA.
+type JarSignature struct {
+	// Name is the name of the signer, the base name of the files.
+	Name string
+
+	// File is the signature file, and nil if there is none.
+	File *Manifest
+
+	// Block is the content of the signature block, a PKCS #7 signature
+	// over File which is not verified here, and BlockName its name.
+	Block     []byte
+	BlockName string
+
+	// ManifestVerified reports whether the digests of File match the
+	// manifest, either as a whole or section by section.
+	ManifestVerified bool
+}
+
+// A Jar is what ReadJar found in a Java archive.
+type Jar struct {
+	// Manifest is the manifest, or nil if there is none.
+	Manifest *Manifest
+
+	// Signatures are the signatures, sorted by name.
+	Signatures []*JarSignature
+
+	// Marker reports whether an entry carries the JAR marker extra field
+	// (0xcafe), which the jar tool adds to the first entry.
+	Marker bool
+
+	// Verified are the entries whose content matches every digest of
+	// the manifest that was computed, and Mismatched those which do not,
+	// or which are named as another entry: only one copy of an entry can
+	// be what the signer meant.
+	Verified   []string
+	Mismatched []string
+
+	// Unverified are the entries of the manifest whose content was not
+	// read or has no digest that was computed.
+	Unverified []string
+
+	// Unlisted are the entries with no section in the manifest, other
+	// than directories and the manifest and signatures themselves.
+	Unlisted []string
+
+	// Missing are the sections of the manifest without an entry.
+	Missing []string
+}
+
+// ReadJar reads the Java archive (JAR, WAR, EAR...) of r to its end, and
+// verifies the digests of the manifest against the content of the entries
+// in the same pass.
+//
+// fn, if not nil, is called for each entry as by Walk. The manifest and
+// signature files are read into memory first, and fn gets a reader of
+// what was read. The content of other entries is hashed as it is read and
+// whatever fn leaves of it: entries which fn skips with SkipEntry are not
+// verified.
+//
+// The digests computed are SHA-256 and SHA-1 until the manifest is read,
+// which is usually the first entry, and then those the manifest uses. The
+// digests set on r with SetDigests are replaced.
+//
+// ErrManifest is returned if the manifest or a signature file is found
+// twice, as there is no telling which one was meant.
+func ReadJar(r *Reader, fn WalkFunc) (*Jar, error) {
+	jar := new(Jar)
+	signatures := make(map[string]*JarSignature)
+	sums := make(map[string]map[string][]byte)
+	skipped := make(map[string]bool)
+	seen := make(map[string]bool)
+	duplicates := make(map[string]bool)
+
+	r.SetDigests(SHA256, SHA1)
+	err := r.Walk(func(e *Entry, content io.Reader) error {
+		if e.Extras.JAR {
+			jar.Marker = true
+		}
+		kind := jarFileKind(e.Name)
+		if !strings.HasSuffix(e.Name, "/") {
+			if seen[e.Name] {
+				if kind != "" {
+					return ErrManifest // Which one is signed?
+				}
+				duplicates[e.Name] = true
+			}
+			seen[e.Name] = true
+		}
+		if kind == "" {
+			var err error
+			if fn != nil {
+				err = fn(e, content)
+			}
+			switch err {
+			case nil:
+				if _, err := io.Copy(ioutil.Discard, content); err != nil {
+					return err
+				}
+				if !strings.HasSuffix(e.Name, "/") {
+					sums[e.Name] = e.Digests()
+				}
+			case SkipEntry:
+				skipped[e.Name] = true
+			}
+			return err
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(content, maxJarMetaSize+1))
+		if err != nil {
+			return err
+		}
+		if len(b) > maxJarMetaSize {
+			return ErrLimit
+		}
+		switch kind {
+		case "manifest":
+			if jar.Manifest, err = ParseManifest(b); err != nil {
+				return err
+			}
+			r.SetDigests(manifestDigests(jar.Manifest)...)
+		case "SF":
+			sig := jarSignature(signatures, e.Name)
+			if sig.File, err = ParseManifest(b); err != nil {
+				return err
+			}
+		default:
+			sig := jarSignature(signatures, e.Name)
+			sig.Block, sig.BlockName = b, e.Name
+		}
+		if fn != nil {
+			return fn(e, bytes.NewReader(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return jar, err
+	}
+
+	for _, sig := range signatures {
+		jar.Signatures = append(jar.Signatures, sig)
+	}
+	sort.Slice(jar.Signatures, func(i, j int) bool { return jar.Signatures[i].Name < jar.Signatures[j].Name })
+	if jar.Manifest != nil {
+		jar.verify(sums, skipped, duplicates)
+	}
+	return jar, nil
+}
+
+// jarFileKind tells the manifest ("manifest"), signature files ("SF") and
+// signature blocks ("RSA", "DSA" or "EC") from other entries ("").
+func jarFileKind(name string) string {
+	upper := strings.ToUpper(name)
+	if upper == manifestName {
+		return "manifest"
+	}
+	if dir, file := path.Split(upper); dir == "META-INF/" {
+		switch ext := path.Ext(file); ext {
+		case ".SF", ".RSA", ".DSA", ".EC":
+			return ext[1:]
+		}
+	}
+	return ""
+}
+
+// jarSignature returns the signature of the signature file or block name.
+func jarSignature(signatures map[string]*JarSignature, name string) *JarSignature {
+	base := path.Base(name)
+	base = strings.ToUpper(base[:len(base)-len(path.Ext(base))])
+	sig := signatures[base]
+	if sig == nil {
+		sig = &JarSignature{Name: base}
+		signatures[base] = sig
+	}
+	return sig
+}
+
+// manifestDigests returns the digests used by the sections of m.
+func manifestDigests(m *Manifest) []Digest {
+	var digests []Digest
+	seen := make(map[string]bool)
+	for _, attrs := range m.Entries {
+		for key := range attrs {
+			d, ok := jarDigests[strings.TrimSuffix(key, "-Digest")]
+			if ok && strings.HasSuffix(key, "-Digest") && !seen[d.Name] {
+				seen[d.Name] = true
+				digests = append(digests, d)
+			}
+		}
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].Name < digests[j].Name })
+	return digests
+}
+
+// verify compares the digests of the entries with the manifest, and the
+// signature files with the manifest.
+func (jar *Jar) verify(sums map[string]map[string][]byte, skipped, duplicates map[string]bool) {
+	m := jar.Manifest
+	for name := range duplicates {
+		jar.Mismatched = append(jar.Mismatched, name)
+	}
+	for name, sum := range sums {
+		if duplicates[name] {
+			continue
+		}
+		attrs, ok := m.Entries[name]
+		if !ok {
+			jar.Unlisted = append(jar.Unlisted, name)
+			continue
+		}
+		switch digestsMatch(attrs, "-Digest", sum) {
+		case 1:
+			jar.Verified = append(jar.Verified, name)
+		case -1:
+			jar.Mismatched = append(jar.Mismatched, name)
+		default:
+			jar.Unverified = append(jar.Unverified, name)
+		}
+	}
+	for name := range m.Entries {
+		if _, ok := sums[name]; ok || duplicates[name] {
+			continue
+		}
+		if skipped[name] {
+			jar.Unverified = append(jar.Unverified, name)
+		} else {
+			jar.Missing = append(jar.Missing, name)
+		}
+	}
+	for _, list := range [][]string{jar.Verified, jar.Mismatched, jar.Unverified, jar.Unlisted, jar.Missing} {
+		sort.Strings(list)
+	}
+
+	for _, sig := range jar.Signatures {
+		if sig.File != nil {
+			sig.ManifestVerified = m.signedBy(sig.File)
+		}
+	}
+}
+
+// signedBy reports whether the digests of the signature file sf match m.
+func (m *Manifest) signedBy(sf *Manifest) bool {
+	if digestsMatch(sf.Main, "-Digest-Manifest", hashAll(m.raw)) == 1 {
+		return true
+	}
+	// Otherwise each section of the manifest must match.
+	if digestsMatch(sf.Main, "-Digest-Manifest-Main-Attributes", hashAll(m.mainRaw)) == -1 {
+		return false
+	}
+	if len(sf.Entries) == 0 {
+		return false
+	}
+	for name, attrs := range sf.Entries {
+		raw, ok := m.sections[name]
+		if !ok || digestsMatch(attrs, "-Digest", hashAll(raw)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashAll returns the digests of jarDigests of b, by digest name.
+func hashAll(b []byte) map[string][]byte {
+	sums := make(map[string][]byte)
+	for _, d := range jarDigests {
+		if _, ok := sums[d.Name]; !ok {
+			h := d.New()
+			h.Write(b)
+			sums[d.Name] = h.Sum(nil)
+		}
+	}
+	return sums
+}
+
+// digestsMatch compares the "<algorithm><suffix>" attributes of attrs with
+// sums, the digests by name. It returns 1 if at least one was compared and
+// all match, -1 if one differs, and 0 if none could be compared.
+func digestsMatch(attrs Attributes, suffix string, sums map[string][]byte) int {
+	result := 0
+	for key, value := range attrs {
+		if !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		d, ok := jarDigests[strings.TrimSuffix(key, suffix)]
+		if !ok {
+			continue
+		}
+		sum, ok := sums[d.Name]
+		if !ok {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil || !bytes.Equal(want, sum) {
+			return -1
+		}
+		result = 1
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package zipstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func TestParseManifest(t *testing.T) {
+	m, err := ParseManifest([]byte("Manifest-Version: 1.0\r\nMain-Class: com.example.Ma\r\n in\r\nClass-Path: lib/a.jar  lib/b.jar\r\n\r\n" +
+		"Name: com/example/Main.class\r\nSHA-256-Digest: abc=\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MainClass() != "com.example.Main" {
+		t.Errorf("Main-Class %q", m.MainClass())
+	}
+	if cp := m.ClassPath(); !reflect.DeepEqual(cp, []string{"lib/a.jar", "lib/b.jar"}) {
+		t.Errorf("Class-Path %q", cp)
+	}
+	if m.Entries["com/example/Main.class"]["SHA-256-Digest"] != "abc=" {
+		t.Errorf("sections %v", m.Entries)
+	}
+	if _, err := ParseManifest([]byte("Manifest-Version: 1.0\n\nSHA-256-Digest: abc=\n")); err != ErrManifest {
+		t.Errorf("section without a name: %v, want %v", err, ErrManifest)
+	}
+}
+
+func sha256Base64(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signedJar returns a JAR of files signed by "SIGNER", with the manifest
+// first as the jar tool writes it. Names missing from files are listed in
+// the manifest only.
+func signedJar(t *testing.T, files map[string]string, names ...string) []byte {
+	manifest := "Manifest-Version: 1.0\r\nMain-Class: a.Main\r\n\r\n"
+	sf := "Signature-Version: 1.0\r\n"
+	var sections string
+	for _, name := range names {
+		section := fmt.Sprintf("Name: %s\r\nSHA-256-Digest: %s\r\n\r\n", name, sha256Base64([]byte(files[name])))
+		sections += fmt.Sprintf("Name: %s\r\nSHA-256-Digest: %s\r\n\r\n", name, sha256Base64([]byte(section)))
+		manifest += section
+	}
+	sf += "SHA-256-Digest-Manifest: " + sha256Base64([]byte(manifest)) + "\r\n\r\n" + sections
+
+	entries := []testEntry{
+		{h: zip.FileHeader{Name: "META-INF/", Extra: []byte{0xfe, 0xca, 0, 0}}},
+		deflated(manifestName, manifest),
+		deflated("META-INF/SIGNER.SF", sf),
+		deflated("META-INF/SIGNER.RSA", "signature block"),
+	}
+	for _, name := range names {
+		if content, ok := files[name]; ok {
+			entries = append(entries, deflated(name, content))
+		}
+	}
+	return testZip(t, "", append(entries, deflated("unlisted.txt", "unlisted"))...)
+}
+
+func TestReadJar(t *testing.T) {
+	files := map[string]string{
+		"a/Main.class": "\xca\xfe\xba\xbe main",
+		"a/B.class":    "\xca\xfe\xba\xbe b",
+		"a/C.class":    "\xca\xfe\xba\xbe c",
+	}
+	z := signedJar(t, files, "a/Main.class", "a/B.class", "a/C.class")
+
+	var seen []string
+	jar, err := ReadJar(NewReader(bytes.NewReader(z)), func(e *Entry, content io.Reader) error {
+		seen = append(seen, e.Name)
+		if e.Name == "a/C.class" {
+			return SkipEntry
+		}
+		_, err := ioutil.ReadAll(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 8 {
+		t.Errorf("fn called for %q", seen)
+	}
+	if jar.Manifest == nil || jar.Manifest.MainClass() != "a.Main" || !jar.Marker {
+		t.Fatalf("jar %+v", jar)
+	}
+	if !reflect.DeepEqual(jar.Verified, []string{"a/B.class", "a/Main.class"}) ||
+		!reflect.DeepEqual(jar.Unverified, []string{"a/C.class"}) ||
+		!reflect.DeepEqual(jar.Unlisted, []string{"unlisted.txt"}) ||
+		len(jar.Mismatched) != 0 || len(jar.Missing) != 0 {
+		t.Errorf("verified %q, unverified %q, unlisted %q, mismatched %q, missing %q",
+			jar.Verified, jar.Unverified, jar.Unlisted, jar.Mismatched, jar.Missing)
+	}
+	if len(jar.Signatures) != 1 {
+		t.Fatalf("%d signatures", len(jar.Signatures))
+	}
+	if sig := jar.Signatures[0]; sig.Name != "SIGNER" || !sig.ManifestVerified || string(sig.Block) != "signature block" {
+		t.Errorf("signature %+v", sig)
+	}
+
+	// A section without an entry
+	z = signedJar(t, files, "a/Main.class", "a/X.class")
+	if jar, err = ReadJar(NewReader(bytes.NewReader(z)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jar.Missing, []string{"a/X.class"}) || !jar.Signatures[0].ManifestVerified {
+		t.Errorf("missing %q, signature verified %v", jar.Missing, jar.Signatures[0].ManifestVerified)
+	}
+
+	// A manifest changed after it was signed
+	sf := jar.Signatures[0].File
+	m, err := ParseManifest(append(jar.Manifest.raw, "Name: a/Y.class\r\nSHA-256-Digest: abc=\r\n\r\n"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.signedBy(sf) {
+		t.Error("sections still signed: not verified")
+	}
+	m.sections["a/Main.class"] = []byte("Name: a/Main.class\r\n\r\n")
+	if m.signedBy(sf) {
+		t.Error("changed section verified")
+	}
+}
+
+func TestReadJarMismatch(t *testing.T) {
+	files := map[string]string{"a/B.class": "\xca\xfe\xba\xbe b"}
+	jar, err := ReadJar(NewReader(bytes.NewReader(signedJar(t, files, "a/B.class"))), nil)
+	if err != nil || len(jar.Verified) != 1 {
+		t.Fatalf("%v %+v", err, jar)
+	}
+
+	z := testZip(t, "",
+		deflated(manifestName, "Manifest-Version: 1.0\r\n\r\nName: b\r\nSHA-256-Digest: "+sha256Base64([]byte("b"))+"\r\n\r\n"),
+		deflated("b", "B"),
+	)
+	if jar, err = ReadJar(NewReader(bytes.NewReader(z)), nil); err != nil || !reflect.DeepEqual(jar.Mismatched, []string{"b"}) {
+		t.Errorf("%v, mismatched %q", err, jar.Mismatched)
+	}
+}
+
+func TestReadJarDuplicates(t *testing.T) {
+	good := "\xca\xfe\xba\xbe b"
+	manifest := deflated(manifestName, "Manifest-Version: 1.0\r\n\r\nName: a/B.class\r\nSHA-256-Digest: "+sha256Base64([]byte(good))+"\r\n\r\n")
+
+	// A malicious copy hidden behind the signed one
+	z := testZip(t, "", manifest, deflated("a/B.class", "evil"), deflated("a/B.class", good))
+	jar, err := ReadJar(NewReader(bytes.NewReader(z)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jar.Mismatched, []string{"a/B.class"}) || len(jar.Verified) != 0 {
+		t.Errorf("verified %q, mismatched %q", jar.Verified, jar.Mismatched)
+	}
+
+	z = testZip(t, "", manifest, deflated("a/B.class", good), manifest)
+	if _, err := ReadJar(NewReader(bytes.NewReader(z)), nil); err != ErrManifest {
+		t.Errorf("manifest twice: %v, want %v", err, ErrManifest)
+	}
+}
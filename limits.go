@@ -0,0 +1,169 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// ErrLimit is returned when an archive exceeds one of the Limits of a
+// Reader.
+var ErrLimit = errors.New("zipstream: archive exceeds limits")
+
+// minRatioSize is the uncompressed size from which Limits.MaxRatio is
+// enforced, since small entries of repeated bytes legitimately compress
+// very well.
+const minRatioSize = 1 << 20
+
+// Limits bound what a Reader decompresses, as a defence against archives
+// crafted to decompress to far more than they hold (zip bombs). A zero
+// field sets no limit.
+type Limits struct {
+	// MaxEntries is the number of entries Next returns.
+	MaxEntries int
+
+	// MaxEntrySize is the uncompressed size of an entry.
+	MaxEntrySize int64
+
+	// MaxTotalSize is the uncompressed size of all the entries read.
+	MaxTotalSize int64
+
+	// MaxRatio is the ratio of the uncompressed size of an entry to its
+	// compressed size, enforced once 1 MiB has been decompressed.
+	MaxRatio float64
+}
+
+// limits is the state of the Limits of a Reader.
+type limits struct {
+	Limits
+	entries int
+	total   int64
+}
+
+// SetLimits sets the limits enforced from the next entry on. Next fails
+// with ErrLimit when the entries or their declared sizes exceed them, and
+// reading content fails with ErrLimit as soon as the decompressed content
+// does, so that nothing past the limits is decompressed. Entries are not
+// read ahead while limits are set, whatever SetConcurrency selected.
+func (r *Reader) SetLimits(l Limits) {
+	r.limits = &limits{Limits: l}
+}
+
+// open checks the declared sizes of the entry of f against the limits and
+// counts it.
+func (l *limits) open(f *zip.FileHeader, descriptor bool) error {
+	if l.entries++; l.MaxEntries > 0 && l.entries > l.MaxEntries {
+		return ErrLimit
+	}
+	if descriptor {
+		return nil
+	}
+	size, csize := int64(f.UncompressedSize64), int64(f.CompressedSize64)
+	if l.exceeded(size, size, csize) {
+		return ErrLimit
+	}
+	return nil
+}
+
+// exceeded reports whether an entry of which n bytes were decompressed,
+// out of the compressed bytes read, exceeds the limits along with the
+// entries before it.
+func (l *limits) exceeded(n, size, read int64) bool {
+	switch {
+	case size < 0:
+		return true
+	case l.MaxEntrySize > 0 && size > l.MaxEntrySize:
+		return true
+	case l.MaxTotalSize > 0 && l.total+n > l.MaxTotalSize:
+		return true
+	case l.MaxRatio > 0 && size > minRatioSize && float64(size) > l.MaxRatio*float64(read):
+		return true
+	}
+	return false
+}
+
+// limitReader fails with ErrLimit once the content read through it exceeds
+// the limits.
+type limitReader struct {
+	io.Reader
+	limits *limits
+	raw    *countReader // compressed content
+	size   int64
+	err    error
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	n, err := lr.Reader.Read(p)
+	if lr.add(n) {
+		return 0, lr.err
+	}
+	return n, err
+}
+
+func (lr *limitReader) WriteTo(w io.Writer) (int64, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	n, err := copyBuffer(limitWriter{w, lr}, lr.Reader)
+	if lr.err != nil {
+		err = lr.err
+	}
+	return n, err
+}
+
+// add counts n more bytes of content, and reports whether they exceed the
+// limits.
+func (lr *limitReader) add(n int) bool {
+	if lr.limits.exceeded(int64(n), lr.size+int64(n), lr.raw.n) {
+		lr.err = ErrLimit
+		return true
+	}
+	lr.size += int64(n)
+	lr.limits.total += int64(n)
+	return false
+}
+
+// limitWriter checks the content written through it against the limits
+// before writing it.
+type limitWriter struct {
+	w  io.Writer
+	lr *limitReader
+}
+
+func (w limitWriter) Write(p []byte) (int, error) {
+	if w.lr.add(len(p)) {
+		return 0, ErrLimit
+	}
+	return w.w.Write(p)
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) WriteTo(w io.Writer) (int64, error) {
+	return copyBuffer(countWriter{w, &c.n}, c.Reader)
+}
+
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
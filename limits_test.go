@@ -0,0 +1,75 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// bombZip returns an archive of entries of size bytes of zeros each.
+func bombZip(t *testing.T, entries, size int, descriptor bool) []byte {
+	var es []testEntry
+	content := string(make([]byte, size))
+	for i := 0; i < entries; i++ {
+		e := deflated(string(rune('a'+i)), content)
+		e.sized = !descriptor
+		es = append(es, e)
+	}
+	return testZip(t, "", es...)
+}
+
+// readLimited reads every entry of z with limits l, returning the error
+// reading failed with.
+func readLimited(z []byte, l Limits) error {
+	r := NewReader(bytes.NewReader(z))
+	r.SetLimits(l)
+	r.SetConcurrency(4, 64<<20)
+	for {
+		if _, err := r.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return err
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, descriptor := range []bool{false, true} {
+		z := bombZip(t, 3, 4<<20, descriptor)
+		for _, test := range []struct {
+			limits Limits
+			err    error
+		}{
+			{Limits{}, nil},
+			{Limits{MaxEntries: 3, MaxEntrySize: 4 << 20, MaxTotalSize: 12 << 20, MaxRatio: 2000}, nil},
+			{Limits{MaxEntries: 2}, ErrLimit},
+			{Limits{MaxEntrySize: 4<<20 - 1}, ErrLimit},
+			{Limits{MaxTotalSize: 12<<20 - 1}, ErrLimit},
+			{Limits{MaxRatio: 100}, ErrLimit},
+		} {
+			if err := readLimited(z, test.limits); err != test.err {
+				t.Errorf("descriptor %v: %+v: %v, want %v", descriptor, test.limits, err, test.err)
+			}
+		}
+	}
+}
+
+// A size lying in the header does not get past the limits.
+func TestLimitsDeclaredSize(t *testing.T) {
+	z := bombZip(t, 1, 4<<20, false)
+	copy(z[22:], []byte{1, 0, 0, 0}) // Uncompressed size
+	r := NewReader(bytes.NewReader(z))
+	r.SetLimits(Limits{MaxEntrySize: 1 << 20})
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != ErrLimit || n > 1<<20 {
+		t.Errorf("read %d bytes, %v, want %v", n, err, ErrLimit)
+	}
+}
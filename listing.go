@@ -0,0 +1,165 @@
+package zipstream
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// A ListedEntry is the line written by WriteListing for an entry.
+type ListedEntry struct {
+	Type string `json:"type"` // "entry"
+
+	Name string `json:"name"`
+
+	// RawName is the name as stored, if it is not UTF-8. It is encoded in
+	// base64 like any []byte.
+	RawName []byte `json:"rawName,omitempty"`
+
+	Archive        int    `json:"archive"`
+	HeaderOffset   int64  `json:"headerOffset"`
+	DataOffset     int64  `json:"dataOffset"`
+	Method         uint16 `json:"method"`
+	Flags          uint16 `json:"flags"`
+	DataDescriptor bool   `json:"dataDescriptor"`
+	CompressedSize uint64 `json:"compressedSize"`
+	Size           uint64 `json:"size"`
+	CRC32          uint32 `json:"crc32"`
+
+	// Modified is in RFC 3339 format. It has a time zone offset only when
+	// it is known, from an extended timestamp; MS-DOS times are in the
+	// unknown local time of the writer.
+	Modified string `json:"modified"`
+	Accessed string `json:"accessed,omitempty"`
+	Created  string `json:"created,omitempty"`
+
+	// ExtraIDs are the IDs of the extra fields of the local file header,
+	// in order.
+	ExtraIDs []uint16 `json:"extraIds"`
+}
+
+// A ListedArchive is the line written by WriteListing once an archive is
+// read, after the lines of its entries.
+type ListedArchive struct {
+	Type string `json:"type"` // "archive"
+
+	Archive         int    `json:"archive"`
+	Entries         int    `json:"entries"`
+	CompressedSize  uint64 `json:"compressedSize"`
+	Size            uint64 `json:"size"`
+	ArchiveOffset   int64  `json:"archiveOffset"`
+	DirectoryOffset int64  `json:"directoryOffset"`
+	DirectoryFiles  int    `json:"directoryFiles"`
+	Comment         string `json:"comment"`
+
+	// Missing are the names of the files of the central directory that
+	// were not found in the stream.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// localTimeFormat is RFC 3339 without a time zone.
+const localTimeFormat = "2006-01-02T15:04:05"
+
+// WriteListing writes a listing of the next archive of r to w as newline
+// delimited JSON: a ListedEntry per entry, then a ListedArchive. With
+// SetConcatenated, every archive of the stream is listed, each followed by
+// its ListedArchive. The content of the entries is skipped without being
+// decompressed, so entries with an unsupported method are listed too.
+// Every line is written as soon as it is known, for the listing to be
+// consumed as the archive is read.
+func WriteListing(w io.Writer, r *Reader) error {
+	enc := json.NewEncoder(w)
+	summary := &ListedArchive{Type: "archive", Archive: r.archive}
+	dir := r.directory
+	for {
+		_, err := r.Next()
+		if d := r.directory; d != dir && err != io.EOF {
+			// The archive ended before this entry, of the one that
+			// follows it.
+			dir = d
+			summary.setDirectory(d)
+			if err := enc.Encode(summary); err != nil {
+				return err
+			}
+			summary = &ListedArchive{Type: "archive", Archive: r.archive}
+		}
+		if err == io.EOF {
+			break
+		}
+		e := r.entry
+		switch err {
+		case nil:
+			err = r.skipEntry()
+		case zip.ErrAlgorithm:
+			err = r.skipUnsupported()
+		}
+		if err != nil {
+			return err
+		}
+		summary.Entries++
+		summary.CompressedSize += e.CompressedSize64
+		summary.Size += e.UncompressedSize64
+		if err := enc.Encode(listedEntry(e)); err != nil {
+			return err
+		}
+	}
+
+	if d := r.directory; d != nil && d.Archive == summary.Archive {
+		summary.setDirectory(d)
+	}
+	return enc.Encode(summary)
+}
+
+// setDirectory sets the fields of a from the central directory d of its
+// archive.
+func (a *ListedArchive) setDirectory(d *Directory) {
+	a.ArchiveOffset = d.ArchiveOffset
+	a.DirectoryOffset = d.Offset
+	a.DirectoryFiles = len(d.Files)
+	a.Comment = d.Comment
+	for _, f := range d.Missing {
+		a.Missing = append(a.Missing, f.Name)
+	}
+}
+
+func listedEntry(e *Entry) *ListedEntry {
+	l := &ListedEntry{
+		Type:           "entry",
+		Name:           e.Name,
+		Archive:        e.Archive,
+		HeaderOffset:   e.HeaderOffset,
+		DataOffset:     e.DataOffset,
+		Method:         e.Method,
+		Flags:          e.Flags,
+		DataDescriptor: e.DataDescriptor,
+		CompressedSize: e.CompressedSize64,
+		Size:           e.UncompressedSize64,
+		CRC32:          e.CRC32,
+		ExtraIDs:       []uint16{},
+	}
+	if e.NonUTF8 {
+		l.RawName = e.RawName
+	}
+	if e.Extras.Modified.IsZero() {
+		l.Modified = e.Modified.Format(localTimeFormat)
+	} else {
+		l.Modified = e.Modified.Format(time.RFC3339)
+	}
+	if !e.Extras.Accessed.IsZero() {
+		l.Accessed = e.Extras.Accessed.Format(time.RFC3339)
+	}
+	if !e.Extras.Created.IsZero() {
+		l.Created = e.Extras.Created.Format(time.RFC3339)
+	}
+	for b := readBuf(e.Extra); len(b) >= 4; {
+		id, size := b.uint16(), int(b.uint16())
+		l.ExtraIDs = append(l.ExtraIDs, id)
+		if len(b) < size {
+			break
+		}
+		b.sub(size)
+	}
+	return l
+}
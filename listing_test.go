@@ -0,0 +1,100 @@
+package zipstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestWriteListing(t *testing.T) {
+	var buf bytes.Buffer
+	for _, name := range []string{"time-infozip.zip", "dd.zip"} {
+		z, err := ioutil.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteListing(&buf, NewReader(bytes.NewReader(z))); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	var lines []map[string]interface{}
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var m map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("%s: %v", sc.Bytes(), err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("%d lines, want 4", len(lines))
+	}
+
+	// Info-ZIP stores an extended timestamp, so the time zone is known.
+	e := lines[0]
+	if e["type"] != "entry" || e["name"] != "test.txt" || e["modified"] != "2017-10-31T21:11:57-07:00" {
+		t.Errorf("entry %v", e)
+	}
+	if ids, _ := e["extraIds"].([]interface{}); len(ids) != 2 || ids[0] != float64(0x5455) {
+		t.Errorf("extra IDs %v", e["extraIds"])
+	}
+	if a := lines[1]; a["type"] != "archive" || a["entries"] != float64(1) || a["directoryFiles"] != float64(1) {
+		t.Errorf("summary %v", a)
+	}
+
+	// The sizes of an entry with a data descriptor are read from it.
+	if e := lines[2]; e["dataDescriptor"] != true || e["size"] == float64(0) {
+		t.Errorf("entry %v", e)
+	}
+}
+
+func TestWriteListingRawName(t *testing.T) {
+	z := walkZip(t, "a")
+	i := bytes.Index(z, []byte("a"))
+	z[i] = 0xff
+	var buf bytes.Buffer
+	if err := WriteListing(&buf, NewReader(bytes.NewReader(z))); err != nil {
+		t.Fatal(err)
+	}
+	var e ListedEntry
+	if err := json.NewDecoder(&buf).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(e.RawName, []byte{0xff}) {
+		t.Errorf("raw name %q", e.RawName)
+	}
+}
+
+func TestWriteListingConcatenated(t *testing.T) {
+	r := NewReader(bytes.NewReader(concatenatedZips(t)))
+	r.SetConcatenated(true)
+	var buf bytes.Buffer
+	if err := WriteListing(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	// Every archive is summarized once its entries are listed.
+	var got []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var l struct {
+			ListedArchive
+			Name string
+		}
+		if err := json.Unmarshal(line, &l); err != nil {
+			t.Fatal(err)
+		}
+		if l.Type == "entry" {
+			got = append(got, l.Name)
+		} else {
+			got = append(got, fmt.Sprintf("%d:%d/%d", l.Archive, l.Entries, l.DirectoryFiles))
+		}
+	}
+	want := []string{"a", "b", "0:2/2", "c", "1:1/1", "d", "e", "f", "2:3/3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package zipstream
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A NameDecoder converts an entry name stored in a legacy encoding to UTF-8.
+type NameDecoder func(raw []byte) (string, error)
+
+// A BytesDecoder converts bytes in some encoding to UTF-8. It is satisfied by
+// *encoding.Decoder from golang.org/x/text, so that the Shift-JIS, GBK,
+// EUC-KR and CP866 decoders found there can be used through DecoderFrom:
+//
+//	r.SetNameDecoder(zipstream.DecoderFrom(japanese.ShiftJIS.NewDecoder()))
+type BytesDecoder interface {
+	Bytes(b []byte) ([]byte, error)
+}
+
+// errInvalidName is returned by decoders for bytes they cannot decode.
+var errInvalidName = errors.New("zipstream: name not valid in encoding")
+
+// DecoderFrom returns a NameDecoder that decodes with d. Decoders from
+// golang.org/x/text replace invalid input with U+FFFD rather than fail; such
+// output is rejected, so that DetectNameDecoder can move on to another
+// candidate.
+func DecoderFrom(d BytesDecoder) NameDecoder {
+	return func(raw []byte) (string, error) {
+		b, err := d.Bytes(raw)
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < len(b); {
+			r, size := utf8.DecodeRune(b[i:])
+			if r == utf8.RuneError {
+				return "", errInvalidName
+			}
+			i += size
+		}
+		return string(b), nil
+	}
+}
+
+// CP437 decodes IBM code page 437, the only encoding other than UTF-8 that
+// the zip specification allows for names.
+func CP437(raw []byte) (string, error) {
+	s := make([]rune, len(raw))
+	for i, c := range raw {
+		if c < 0x80 {
+			s[i] = rune(c)
+		} else {
+			s[i] = cp437[c-0x80]
+		}
+	}
+	return string(s), nil
+}
+
+// cp437 holds the upper half of code page 437.
+var cp437 = [128]rune{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
+
+// DetectNameDecoder returns a NameDecoder that guesses the encoding of each
+// name. Names that are valid UTF-8 are kept as they are, since many writers
+// do not set the UTF-8 flag. Otherwise every candidate, followed by CP437,
+// decodes the name and the output that looks most like text wins; ties go to
+// the earlier candidate, so candidates should be listed from most to least
+// likely for the archives at hand.
+func DetectNameDecoder(candidates ...NameDecoder) NameDecoder {
+	candidates = append(candidates[:len(candidates):len(candidates)], CP437)
+	return func(raw []byte) (string, error) {
+		if utf8.Valid(raw) {
+			return string(raw), nil
+		}
+		var (
+			best      string
+			bestScore = -1e9
+		)
+		for _, dec := range candidates {
+			s, err := dec(raw)
+			if err != nil {
+				continue
+			}
+			if score := textScore(s); score > bestScore {
+				best, bestScore = s, score
+			}
+		}
+		return best, nil
+	}
+}
+
+// textScore rates how plausible s is as a file name: letters, digits and
+// ASCII punctuation count for it, symbols and control characters (which is
+// what a wrong single-byte code page produces) count against it.
+func textScore(s string) float64 {
+	var n, score float64
+	for _, r := range s {
+		n++
+		switch {
+		case r < utf8.RuneSelf && unicode.IsPrint(r),
+			unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsSpace(r):
+			score++
+		case unicode.IsSymbol(r), unicode.IsControl(r),
+			unicode.Is(unicode.Co, r), r == utf8.RuneError:
+			score -= 3
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return score / n
+}
+
+// SetNameDecoder sets the decoder used for entry names that are not UTF-8.
+// A name that dec fails to decode is left as it is. The name as stored in
+// the archive remains available through RawName.
+func (r *Reader) SetNameDecoder(dec NameDecoder) {
+	r.nameDecoder = dec
+}
+
+// RawName returns the name of the current entry as stored in its local file
+// header, before any Unicode Path field or NameDecoder was applied.
+func (r *Reader) RawName() []byte {
+	if r.entry == nil {
+		return nil
+	}
+	return r.entry.RawName
+}
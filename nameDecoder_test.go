@@ -0,0 +1,72 @@
+package zipstream
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestNameDecoder(t *testing.T) {
+	tests := []struct {
+		dec  NameDecoder
+		name string
+	}{
+		{nil, "世界"},
+		{CP437, "Σ╕ûτòî"},
+		{DetectNameDecoder(), "世界"},
+	}
+	for _, tt := range tests {
+		f, err := os.Open("testdata/utf8-osx.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(f)
+		r.SetNameDecoder(tt.dec)
+		h, err := r.Next()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != tt.name {
+			t.Errorf("Name = %q, want %q", h.Name, tt.name)
+		}
+		if h.NonUTF8 != (tt.dec == nil) {
+			t.Errorf("NonUTF8 = %v with decoder %v", h.NonUTF8, tt.dec != nil)
+		}
+		if string(r.RawName()) != "世界" {
+			t.Errorf("RawName = %q, want %q", r.RawName(), "世界")
+		}
+	}
+}
+
+// fakeDecoder decodes a fixed set of byte sequences, replacing anything
+// else with U+FFFD like the golang.org/x/text decoders.
+type fakeDecoder map[string]string
+
+func (d fakeDecoder) Bytes(b []byte) ([]byte, error) {
+	if s, ok := d[string(b)]; ok {
+		return []byte(s), nil
+	}
+	return bytes.Repeat([]byte("�"), len(b)), nil
+}
+
+func TestDetectNameDecoder(t *testing.T) {
+	sjis := DecoderFrom(fakeDecoder{"\x93\xfa\x96\x7b": "日本"})
+	if _, err := sjis([]byte{0xff}); err == nil {
+		t.Error("DecoderFrom accepted replacement characters")
+	}
+
+	detect := DetectNameDecoder(sjis)
+	tests := []struct {
+		raw, name string
+	}{
+		{"\x93\xfa\x96\x7b", "日本"},
+		{"na\x8bve", "naïve"}, // left to CP437
+		{"plain.txt", "plain.txt"},
+	}
+	for _, tt := range tests {
+		if name, err := detect([]byte(tt.raw)); err != nil || name != tt.name {
+			t.Errorf("detect(%q) = %q, %v, want %q", tt.raw, name, err, tt.name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// nestedSeparator separates the names of nested archives in paths, as in
+// "outer.zip!/lib/a.jar!/META-INF/MANIFEST.MF".
+const nestedSeparator = "!/"
+
+// maxReplay bounds what is kept of an entry taken for an archive until its
+// first entry is found, to read it as a plain entry if it is no archive.
+const maxReplay = 1 << 20
+
+// A NestedWalkFunc is called by NestedWalker.Walk for each entry, with its
+// path through the nested archives and a reader of its content. It returns
+// errors as a WalkFunc does.
+type NestedWalkFunc func(path string, e *Entry, content io.Reader) error
+
+// A NestedWalker walks archives along with the archives they contain, such
+// as JARs inside a WAR. Entries are recognized as archives by the signature
+// their content starts with, and read as they are decompressed, without
+// being held in memory.
+type NestedWalker struct {
+	// Name is the path of the outermost archive, which starts every path.
+	// If it is empty, paths start with the names of its entries.
+	Name string
+
+	// MaxDepth is the number of levels of nested archives descended into,
+	// and zero no limit. Archives deeper than that are entries as any other.
+	MaxDepth int
+
+	// Limits bound what is decompressed of all the archives together.
+	Limits Limits
+}
+
+// nestedWalk is the state of a walk of a NestedWalker.
+type nestedWalk struct {
+	w      *NestedWalker
+	fn     NestedWalkFunc
+	limits *limits
+	err    error // returned by fn
+}
+
+// Walk calls fn for each entry of the archive read from r, and of the
+// archives it contains, depth first in stream order. Entries that are
+// archives are descended into instead of being passed to fn, unless they
+// are deeper than MaxDepth.
+//
+// An entry that starts as an archive but whose first entry cannot be read
+// is passed to fn as any other. Errors reading a nested archive past that
+// are returned wrapped with its path.
+func (w *NestedWalker) Walk(r io.Reader, fn NestedWalkFunc) error {
+	nw := &nestedWalk{w: w, fn: fn, limits: &limits{Limits: w.Limits}}
+	err := nw.walk(NewReader(r), w.Name, 0, nil)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+// walk walks the archive of r, read from rec if it is nested.
+func (nw *nestedWalk) walk(r *Reader, prefix string, depth int, rec *replayReader) error {
+	r.limits = nw.limits
+	return r.Walk(func(e *Entry, content io.Reader) error {
+		if rec != nil {
+			rec.stop() // An archive indeed
+		}
+		path := e.Name
+		if prefix != "" {
+			path = prefix + nestedSeparator + e.Name
+		}
+		if (nw.w.MaxDepth <= 0 || depth < nw.w.MaxDepth) && !strings.HasSuffix(e.Name, "/") {
+			var sig [4]byte
+			n, err := io.ReadFull(content, sig[:])
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			content = io.MultiReader(bytes.NewReader(sig[:n]), content)
+			if n == len(sig) && binary.LittleEndian.Uint32(sig[:]) == fileHeaderSignature {
+				rec := &replayReader{r: content, recording: true}
+				err := nw.walk(NewReader(rec), path, depth+1, rec)
+				if err != nil && err != ErrLimit && rec.recording {
+					// Not an archive after all.
+					content = io.MultiReader(bytes.NewReader(rec.buf), content)
+					nw.err = nw.fn(path, e, content)
+					return nw.err
+				}
+				if err == nil && nw.err == StopWalk {
+					// Stop the archives around this one as well.
+					return StopWalk
+				}
+				if err != nil && err != nw.err {
+					if _, nested := err.(*NestedError); !nested {
+						err = &NestedError{Path: path, Err: err}
+					}
+				}
+				return err
+			}
+		}
+		nw.err = nw.fn(path, e, content)
+		return nw.err
+	})
+}
+
+// A NestedError is an error reading an archive nested in another.
+type NestedError struct {
+	Path string // of the nested archive
+	Err  error
+}
+
+func (e *NestedError) Error() string { return fmt.Sprintf("zipstream: %s: %v", e.Path, e.Err) }
+
+func (e *NestedError) Unwrap() error { return e.Err }
+
+// replayReader records what is read through it until it is stopped, or
+// until it has recorded maxReplay bytes.
+type replayReader struct {
+	r         io.Reader
+	buf       []byte
+	recording bool
+}
+
+func (rr *replayReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if rr.recording {
+		if len(rr.buf)+n > maxReplay {
+			rr.stop()
+		} else {
+			rr.buf = append(rr.buf, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+func (rr *replayReader) stop() {
+	rr.recording = false
+	rr.buf = nil
+}
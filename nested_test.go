@@ -0,0 +1,89 @@
+package zipstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zipOf returns an archive of the given entries, deflated unless their
+// name ends with ".jar".
+func zipOf(t *testing.T, entries ...string) []byte {
+	var es []testEntry
+	for i := 0; i < len(entries); i += 2 {
+		e := deflated(entries[i], entries[i+1])
+		if strings.HasSuffix(e.h.Name, ".jar") {
+			e.h.Method = Store
+		}
+		es = append(es, e)
+	}
+	return testZip(t, "", es...)
+}
+
+func TestNestedWalker(t *testing.T) {
+	jar := zipOf(t, "META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n", "a/A.class", "\xca\xfe\xba\xbe")
+	war := zipOf(t, "index.html", "<html>", "lib/a.jar", string(jar), "lib/b.zip", string(zipOf(t, "b", "b")))
+	outer := zipOf(t, "app.war", string(war), "PK", "PK")
+
+	walk := func(w *NestedWalker, z []byte) ([]string, error) {
+		var paths []string
+		err := w.Walk(bytes.NewReader(z), func(path string, e *Entry, content io.Reader) error {
+			paths = append(paths, path)
+			if e.Name == "stop" {
+				return StopWalk
+			}
+			_, err := ioutil.ReadAll(content)
+			return err
+		})
+		return paths, err
+	}
+
+	paths, err := walk(&NestedWalker{Name: "outer.zip"}, outer)
+	want := []string{
+		"outer.zip!/app.war!/index.html",
+		"outer.zip!/app.war!/lib/a.jar!/META-INF/MANIFEST.MF",
+		"outer.zip!/app.war!/lib/a.jar!/a/A.class",
+		"outer.zip!/app.war!/lib/b.zip!/b",
+		"outer.zip!/PK",
+	}
+	if err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths %q, %v, want %q", paths, err, want)
+	}
+
+	paths, err = walk(&NestedWalker{MaxDepth: 1}, outer)
+	want = []string{"app.war!/index.html", "app.war!/lib/a.jar", "app.war!/lib/b.zip", "PK"}
+	if err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("MaxDepth 1: paths %q, %v, want %q", paths, err, want)
+	}
+
+	// StopWalk ends the walk of every archive.
+	stop := zipOf(t, "in.zip", string(zipOf(t, "stop", "", "after", "")), "after", "")
+	if paths, err = walk(&NestedWalker{}, stop); err != nil || len(paths) != 1 {
+		t.Errorf("StopWalk: paths %q, %v", paths, err)
+	}
+
+	// Limits hold across the archives, and errors tell the nested archive.
+	_, err = walk(&NestedWalker{Name: "outer.zip", Limits: Limits{MaxEntries: 4}}, outer)
+	var nerr *NestedError
+	if !errors.Is(err, ErrLimit) || !errors.As(err, &nerr) || nerr.Path != "outer.zip!/app.war!/lib/a.jar" {
+		t.Errorf("walk over the limits: %v", err)
+	}
+}
+
+func TestNestedWalkerNotArchive(t *testing.T) {
+	fake := "PK\x03\x04 starts as an archive, but is not one"
+	outer := zipOf(t, "fake.zip", fake, "after", "after")
+	var got []string
+	err := (&NestedWalker{}).Walk(bytes.NewReader(outer), func(path string, e *Entry, content io.Reader) error {
+		b, err := ioutil.ReadAll(content)
+		got = append(got, path, string(b))
+		return err
+	})
+	if want := []string{"fake.zip", fake, "after", "after"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, %v, want %q", got, err, want)
+	}
+}
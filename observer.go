@@ -0,0 +1,123 @@
+package zipstream
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// An Observer is notified of the progress of a Reader, to drive progress
+// bars or metrics. Its methods are called on the goroutine using the Reader
+// and should return quickly.
+type Observer interface {
+	// StreamRead is called with the number of bytes read from the
+	// underlying stream, which includes bytes that are buffered but not
+	// consumed yet.
+	StreamRead(n int)
+
+	// JunkSkipped is called with the number of bytes skipped while
+	// looking for a header, such as data preceding an archive.
+	JunkSkipped(n int64)
+
+	// EntryStart is called when Next advances to an entry.
+	EntryStart(h *zip.FileHeader)
+
+	// EntryRead is called as the content of the current entry is read,
+	// with the number of compressed and uncompressed bytes just read.
+	// Either may be zero.
+	EntryRead(h *zip.FileHeader, compressed, uncompressed int)
+
+	// EntryFinish is called once the content of an entry has been read to
+	// the end, or left behind by Next, with the totals read.
+	EntryFinish(h *zip.FileHeader, compressed, uncompressed int64)
+}
+
+// NopObserver implements Observer by doing nothing. It can be embedded to
+// implement only some of the methods.
+type NopObserver struct{}
+
+func (NopObserver) StreamRead(int)                            {}
+func (NopObserver) JunkSkipped(int64)                         {}
+func (NopObserver) EntryStart(*zip.FileHeader)                {}
+func (NopObserver) EntryRead(*zip.FileHeader, int, int)       {}
+func (NopObserver) EntryFinish(*zip.FileHeader, int64, int64) {}
+
+// SetObserver sets the Observer notified of the progress of r.
+func (r *Reader) SetObserver(o Observer) {
+	r.observer = o
+	r.src.observer = o
+}
+
+// entryProgress counts the bytes read of the current entry.
+type entryProgress struct {
+	observer                 Observer
+	header                   *zip.FileHeader
+	compressed, uncompressed int64
+	finished                 bool
+}
+
+func (p *entryProgress) finish() {
+	if !p.finished {
+		p.finished = true
+		p.observer.EntryFinish(p.header, p.compressed, p.uncompressed)
+	}
+}
+
+// progressReader reports the bytes read through it to an entryProgress,
+// either as compressed or as uncompressed bytes.
+type progressReader struct {
+	io.Reader
+	progress *entryProgress
+	raw      bool
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	p := r.progress
+	if r.raw {
+		if n > 0 {
+			p.compressed += int64(n)
+			p.observer.EntryRead(p.header, n, 0)
+		}
+		return
+	}
+	if n > 0 {
+		p.uncompressed += int64(n)
+		p.observer.EntryRead(p.header, 0, n)
+	}
+	if err == io.EOF {
+		p.finish()
+	}
+	return
+}
+
+func (r *progressReader) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = copyBuffer(progressWriter{w, r.progress, r.raw}, r.Reader)
+	if err == nil && !r.raw {
+		r.progress.finish()
+	}
+	return
+}
+
+// progressWriter reports the bytes written through it to an entryProgress.
+type progressWriter struct {
+	w        io.Writer
+	progress *entryProgress
+	raw      bool
+}
+
+func (w progressWriter) Write(b []byte) (n int, err error) {
+	n, err = w.w.Write(b)
+	if n == 0 {
+		return
+	}
+	p := w.progress
+	if w.raw {
+		p.compressed += int64(n)
+		p.observer.EntryRead(p.header, n, 0)
+	} else {
+		p.uncompressed += int64(n)
+		p.observer.EntryRead(p.header, 0, n)
+	}
+	return
+}
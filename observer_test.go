@@ -0,0 +1,82 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+type countingObserver struct {
+	NopObserver
+	streamRead, junk                     int64
+	starts, finishes                     int
+	compressed, uncompressed             int64
+	finishCompressed, finishUncompressed int64
+}
+
+func (o *countingObserver) StreamRead(n int)             { o.streamRead += int64(n) }
+func (o *countingObserver) JunkSkipped(n int64)          { o.junk += n }
+func (o *countingObserver) EntryStart(h *zip.FileHeader) { o.starts++ }
+
+func (o *countingObserver) EntryRead(h *zip.FileHeader, compressed, uncompressed int) {
+	o.compressed += int64(compressed)
+	o.uncompressed += int64(uncompressed)
+}
+
+func (o *countingObserver) EntryFinish(h *zip.FileHeader, compressed, uncompressed int64) {
+	o.finishes++
+	o.finishCompressed += compressed
+	o.finishUncompressed += uncompressed
+}
+
+func TestObserver(t *testing.T) {
+	content := bytes.Repeat([]byte("observed "), 10000)
+
+	stored := deflated("file", string(content))
+	stored.h.Method = Store
+	buf := bytes.NewBuffer(testZip(t, "junk", stored, deflated("file", string(content))))
+	size := int64(buf.Len())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()[4:]), size-4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed int64
+	for _, f := range zr.File {
+		compressed += int64(f.CompressedSize64)
+	}
+
+	o := new(countingObserver)
+	r := NewReader(buf)
+	r.SetObserver(o)
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if o.streamRead != size {
+		t.Errorf("StreamRead total = %d, want %d", o.streamRead, size)
+	}
+	if o.junk != 4 {
+		t.Errorf("JunkSkipped total = %d, want 4", o.junk)
+	}
+	if o.starts != 2 || o.finishes != 2 {
+		t.Errorf("%d starts and %d finishes, want 2 of each", o.starts, o.finishes)
+	}
+	if o.uncompressed != 2*int64(len(content)) || o.finishUncompressed != o.uncompressed {
+		t.Errorf("uncompressed = %d read, %d finished, want %d", o.uncompressed, o.finishUncompressed, 2*len(content))
+	}
+	if o.compressed != compressed || o.finishCompressed != compressed {
+		t.Errorf("compressed = %d read, %d finished, want %d", o.compressed, o.finishCompressed, compressed)
+	}
+}
@@ -0,0 +1,284 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// pipeline reads the compressed content of entries ahead of the caller and
+// decompresses it on other goroutines.
+type pipeline struct {
+	sem      chan struct{} // bounds the number of busy workers
+	limit    int64         // bound on the bytes held by queued jobs
+	maxQueue int           // bound on the number of queued jobs
+	buffered int64
+	queue    []*job
+	err      error // from reading ahead, returned once the queue is drained
+}
+
+// A job is an entry read ahead of the caller. Entries that cannot be read
+// ahead are queued with a nil raw buffer and are streamed as usual once
+// they become current.
+type job struct {
+	entry *Entry
+	size  int64 // bytes held, counted against pipeline.limit
+	raw   *bytes.Buffer
+	out   *bytes.Buffer
+	done  chan struct{}
+
+	// Set by the worker before done is closed.
+	digest *digestReader
+	err    error
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// SetConcurrency enables decompressing entries on up to workers goroutines
+// while the caller reads earlier entries. The compressed content of entries
+// whose size is known from their header is read ahead, as long as the local
+// headers and the compressed and uncompressed content of the entries read
+// ahead fit in maxBuffered bytes, and up to a few entries per worker; other
+// entries are streamed as usual. Entries are still
+// returned by Next in archive order. Reading an entry read ahead fails with
+// zip.ErrFormat if its content is longer than its size.
+//
+// SetConcurrency must be called before the first call to Next. A value of
+// workers below 2 disables read-ahead.
+func (r *Reader) SetConcurrency(workers int, maxBuffered int64) {
+	if workers < 2 {
+		r.pipeline = nil
+		return
+	}
+	r.pipeline = &pipeline{
+		sem:      make(chan struct{}, workers),
+		limit:    maxBuffered,
+		maxQueue: queuedPerWorker * workers,
+	}
+}
+
+func (r *Reader) nextPipelined() (*zip.FileHeader, error) {
+	p := r.pipeline
+	if len(p.queue) == 0 {
+		if err := p.err; err != nil {
+			p.err = nil
+			return nil, err
+		}
+		if err := r.readAhead(); err != nil {
+			return nil, err
+		}
+	}
+	j := p.queue[0]
+	p.queue = p.queue[1:]
+	if j.raw == nil {
+		if err := r.openEntry(j.entry); err != nil {
+			return nil, err
+		}
+		return j.entry.FileHeader, nil
+	}
+
+	r.openJob(j)
+	// Read more while the workers are busy; the stream cannot be read
+	// ahead of an entry that is streamed.
+	if err := r.readAhead(); err != nil {
+		p.err = err
+	}
+	return j.entry.FileHeader, nil
+}
+
+// queuedPerWorker is the number of entries read ahead per worker, which
+// bounds the goroutines waiting for one when entries are small.
+const queuedPerWorker = 4
+
+// readAhead reads entries into the queue until the limits are reached or an
+// entry that has to be streamed is found. With nothing queued or current it
+// reads at least one entry.
+func (r *Reader) readAhead() error {
+	p := r.pipeline
+	for {
+		if n := len(p.queue); n > 0 && p.queue[n-1].raw == nil {
+			return nil
+		}
+		if len(p.queue) > 0 || r.job != nil {
+			if len(p.queue) >= p.maxQueue {
+				return nil
+			}
+			// Only go on if the next header is right there, leaving
+			// anything else to be handled once the queue is drained.
+			b, err := r.br.Peek(fileHeaderLen)
+			if err != nil || binary.LittleEndian.Uint32(b) != fileHeaderSignature {
+				return nil
+			}
+			if size := jobSize(b); size < 0 || p.buffered+size > p.limit {
+				return nil
+			}
+		}
+
+		e, err := r.readHeader()
+		if err != nil {
+			return err
+		}
+		j := &job{entry: e}
+		p.queue = append(p.queue, j)
+		if e.DataDescriptor || r.decompressor(e.Method) == nil {
+			return nil
+		}
+		// The header is held too, and is all an empty entry costs.
+		header := e.DataOffset - e.HeaderOffset
+		if !fits(e.CompressedSize64, e.UncompressedSize64, p.limit-header) {
+			return nil
+		}
+		j.size = header + int64(e.CompressedSize64+e.UncompressedSize64)
+
+		j.raw = bufferPool.Get().(*bytes.Buffer)
+		if _, err := io.CopyN(j.raw, r.br, int64(e.CompressedSize64)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			j.release()
+			p.queue = p.queue[:len(p.queue)-1]
+			return err
+		}
+		p.buffered += j.size
+		j.out = bufferPool.Get().(*bytes.Buffer)
+		j.done = make(chan struct{})
+		go j.run(r.decompressor(e.Method), e.CRC32, e.UncompressedSize64, r.digests, r.rawDigests, p.sem)
+	}
+}
+
+// jobSize returns the size of the local file header starting with b plus
+// the compressed and uncompressed size of its entry, or -1 if it is not
+// known.
+func jobSize(b []byte) int64 {
+	flags := binary.LittleEndian.Uint16(b[6:])
+	csize := binary.LittleEndian.Uint32(b[18:])
+	usize := binary.LittleEndian.Uint32(b[22:])
+	if flags&0x8 != 0 || csize == ^uint32(0) || usize == ^uint32(0) {
+		return -1
+	}
+	header := fileHeaderLen + int64(binary.LittleEndian.Uint16(b[26:])) + int64(binary.LittleEndian.Uint16(b[28:]))
+	return header + int64(csize) + int64(usize)
+}
+
+// fits reports whether the compressed and uncompressed sizes of an entry
+// fit in limit bytes together, without overflowing on crafted sizes.
+func fits(csize, usize uint64, limit int64) bool {
+	return limit >= 0 && csize <= uint64(limit) && usize <= uint64(limit)-csize
+}
+
+// run decompresses the content of j, failing with zip.ErrFormat if it is
+// longer than the size of the entry so that no more than that is held.
+func (j *job) run(dcomp Decompressor, crc uint32, size uint64, digests, rawDigests []Digest, sem chan struct{}) {
+	sem <- struct{}{}
+	defer func() {
+		<-sem
+		close(j.done)
+	}()
+
+	var raw io.Reader = bytes.NewReader(j.raw.Bytes())
+	var rawDigest *digestReader
+	if len(rawDigests) > 0 {
+		rawDigest = newDigestReader(raw, rawDigests)
+		raw = rawDigest
+	}
+	rc := dcomp(raw)
+	defer rc.Close()
+
+	var content io.Reader = &crcReader{Reader: rc, hash: crc32.NewIEEE(), crc: &crc}
+	if len(digests) > 0 || rawDigest != nil {
+		j.digest = newDigestReader(content, digests)
+		j.digest.raw = rawDigest
+		content = j.digest
+	}
+	var n int64
+	n, j.err = j.out.ReadFrom(io.LimitReader(content, int64(size)+1))
+	if j.err == nil && uint64(n) > size {
+		j.err = zip.ErrFormat
+	}
+}
+
+// release returns the buffers of j to the pool.
+func (j *job) release() {
+	for _, b := range []*bytes.Buffer{j.raw, j.out} {
+		if b != nil {
+			b.Reset()
+			bufferPool.Put(b)
+		}
+	}
+	j.raw, j.out = nil, nil
+}
+
+// openJob makes the entry of j the current entry.
+func (r *Reader) openJob(j *job) {
+	r.entry = j.entry
+	r.job = j
+	r.Reader = &jobReader{job: j}
+	if r.observer != nil {
+		f := j.entry.FileHeader
+		r.progress = &entryProgress{observer: r.observer, header: f}
+		r.observer.EntryStart(f)
+		r.progress.compressed = int64(j.raw.Len())
+		r.observer.EntryRead(f, j.raw.Len(), 0)
+		r.Reader = &progressReader{Reader: r.Reader, progress: r.progress}
+	}
+}
+
+// closeJob waits for the worker of the current entry and releases its
+// buffers.
+func (r *Reader) closeJob() {
+	j := r.job
+	<-j.done
+	r.pipeline.buffered -= j.size
+	j.release()
+	r.job = nil
+}
+
+// jobReader reads the content decompressed by a worker.
+type jobReader struct {
+	job *job
+	out *bytes.Reader
+}
+
+func (r *jobReader) Read(b []byte) (int, error) {
+	r.wait()
+	n, err := r.out.Read(b)
+	if err == io.EOF {
+		err = r.finish()
+	}
+	return n, err
+}
+
+func (r *jobReader) WriteTo(w io.Writer) (int64, error) {
+	r.wait()
+	n, err := r.out.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	if err := r.finish(); err != io.EOF {
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *jobReader) wait() {
+	if r.out == nil {
+		<-r.job.done
+		r.out = bytes.NewReader(r.job.out.Bytes())
+	}
+}
+
+// finish returns the error of the worker, or io.EOF after making the
+// digests available on the entry.
+func (r *jobReader) finish() error {
+	if r.job.err != nil {
+		return r.job.err
+	}
+	r.job.entry.digest = r.job.digest
+	return io.EOF
+}
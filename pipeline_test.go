@@ -0,0 +1,178 @@
+package zipstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zip"
+)
+
+func TestPipeline(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var (
+		entries  []testEntry
+		contents [][]byte
+	)
+	for i := 0; i < 40; i++ {
+		content := make([]byte, rnd.Intn(100000))
+		rnd.Read(content[:len(content)/3])
+		contents = append(contents, content)
+		e := deflated(fmt.Sprint(i), string(content))
+		switch i % 5 {
+		case 0:
+			// With a data descriptor
+		case 1:
+			e.h.Method, e.sized = Store, true
+		default:
+			e.sized = true
+		}
+		entries = append(entries, e)
+	}
+
+	r := NewReader(bytes.NewReader(testZip(t, "", entries...)))
+	r.SetConcurrency(4, 300000)
+	r.SetDigests(SHA256)
+	for i := 0; ; i++ {
+		h, err := r.Next()
+		if err == io.EOF {
+			if i != len(contents) {
+				t.Fatalf("read %d entries, want %d", i, len(contents))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != fmt.Sprint(i) {
+			t.Fatalf("entry %d is named %q", i, h.Name)
+		}
+		if i%7 == 6 {
+			continue // left for Next to discard
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, contents[i]) {
+			t.Fatalf("entry %d: content does not match", i)
+		}
+		if sum := sha256.Sum256(b); !bytes.Equal(r.Digests()["sha256"], sum[:]) {
+			t.Fatalf("entry %d: wrong digest", i)
+		}
+	}
+	if r.pipeline.buffered != 0 {
+		t.Errorf("%d bytes still buffered", r.pipeline.buffered)
+	}
+}
+
+func TestPipelineChecksum(t *testing.T) {
+	ok, bad := deflated("ok", "fine content"), deflated("bad", "corrupted content")
+	ok.sized, bad.sized = true, true
+	b := testZip(t, "", ok, bad)
+	i := bytes.Index(b, []byte("bad")) - fileHeaderLen + 14
+	b[i] ^= 0xff // CRC-32 in the local header
+
+	r := NewReader(bytes.NewReader(b))
+	r.SetConcurrency(2, 1<<20)
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != zip.ErrChecksum {
+		t.Fatalf("ReadAll = %v, want %v", err, zip.ErrChecksum)
+	}
+}
+
+func TestPipelineCraftedSizes(t *testing.T) {
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	fw.Write(make([]byte, 8<<20))
+	fw.Close()
+
+	// A zip64 size that overflows when added to the compressed size, and
+	// content much longer than its size.
+	for _, size := range []uint64{0xfffffffffffffff0, 10} {
+		h := &zip.FileHeader{
+			Name:               "crafted",
+			Method:             Deflate,
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: size,
+		}
+		if size > 0xffffffff {
+			// The writer leaves the zip64 field out of local headers.
+			h.Extra = make([]byte, 20)
+			binary.LittleEndian.PutUint16(h.Extra, zip64ExtraID)
+			binary.LittleEndian.PutUint16(h.Extra[2:], 16)
+			binary.LittleEndian.PutUint64(h.Extra[4:], size)
+			binary.LittleEndian.PutUint64(h.Extra[12:], uint64(compressed.Len()))
+		}
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.CreateRaw(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(compressed.Bytes())
+		zw.Close()
+
+		r := NewReader(&buf)
+		r.SetConcurrency(4, 1<<20)
+		f, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.UncompressedSize64 != size {
+			t.Fatalf("size %#x, want %#x", f.UncompressedSize64, size)
+		}
+		if r.job == nil {
+			// Too large to be read ahead, and streamed.
+			continue
+		}
+		if n, err := io.Copy(ioutil.Discard, r); err != zip.ErrFormat {
+			t.Errorf("size %#x: read %d bytes, %v, want %v", size, n, err, zip.ErrFormat)
+		}
+		if n := r.job.out.Len(); uint64(n) > size+1 {
+			t.Errorf("size %#x: %d bytes held", size, n)
+		}
+	}
+}
+
+func TestPipelineEmptyEntries(t *testing.T) {
+	const limit = 10000
+	for _, nameLen := range []int{1, 2000} {
+		var entries []testEntry
+		for i := 0; i < 2000; i++ {
+			e := testEntry{h: zip.FileHeader{Name: fmt.Sprintf("%0*d", nameLen, i)}, sized: true}
+			entries = append(entries, e)
+		}
+
+		r := NewReader(bytes.NewReader(testZip(t, "", entries...)))
+		r.SetConcurrency(4, limit)
+		for i := 0; ; i++ {
+			_, err := r.Next()
+			if err == io.EOF {
+				if i != len(entries) {
+					t.Fatalf("read %d entries, want %d", i, len(entries))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The headers count against the limit, and the queue is
+			// bounded even when they are short.
+			if p := r.pipeline; len(p.queue) > queuedPerWorker*4 || p.buffered > limit {
+				t.Fatalf("name of %d bytes: %d entries, %d bytes queued", nameLen, len(p.queue), p.buffered)
+			}
+		}
+	}
+}
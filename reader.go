@@ -9,16 +9,14 @@ import (
 	"hash/crc32"
 	"io"
 	"io/ioutil"
-	"time"
+	"unicode/utf8"
 
 	"github.com/klauspost/compress/zip"
 )
 
-const (
-	readAhead  = 28
-	maxRead    = 4096
-	bufferSize = maxRead + readAhead
-)
+// bufferSize is the size of the buffer the stream is read through. Entries
+// with a data descriptor are scanned for their end within this buffer.
+const bufferSize = 64 << 10
 
 // A Reader provides sequential access to the contents of a zip archive.
 // A zip archive consists of a sequence of files,
@@ -29,68 +27,255 @@ const (
 type Reader struct {
 	io.Reader
 	br            *bufio.Reader
+	src           *source
+	dcomp         io.ReadCloser // of the current entry
 	decompressors map[uint16]Decompressor
+	nameDecoder   NameDecoder
+	digests       []Digest
+	rawDigests    []Digest
+	entry         *Entry    // current entry
+	raw           io.Reader // compressed content of the current entry
+	pipeline      *pipeline
+	job           *job // of the current entry, if read ahead
+	observer      Observer
+	progress      *entryProgress // of the current entry, if observed
+	concatenated  bool
+	archive       int        // index of the current archive
+	ended         bool       // whether the central directory of the current archive was read
+	directory     *Directory // of the last archive read to its end
+	volumes       *volumes   // if reading a split archive
+	salvage       *Salvage   // in recovery mode
+	seekable      *seekable  // if reading through an io.ReaderAt
+	limits        *limits
+	unlimited     func(*Entry) bool // entries opened without the limits
+	unsupported   bool              // if Next failed with zip.ErrAlgorithm
+
+	// local maps the stream offset of every local file header of the
+	// current archive to the header returned for it, so that attributes
+	// only stored in the central directory can be filled in later.
+	local map[int64]*zip.FileHeader
 }
 
 // NewReader creates a new Reader reading from r.
 func NewReader(r io.Reader) *Reader {
-	return &Reader{br: bufio.NewReaderSize(r, bufferSize)}
+	src := &source{r: r}
+	return &Reader{br: bufio.NewReaderSize(src, bufferSize), src: src}
+}
+
+// offset returns the position in the underlying stream of the next byte
+// that will be returned by r.br.
+func (r *Reader) offset() int64 {
+	return r.src.n - int64(r.br.Buffered())
 }
 
 // Next advances to the next entry in the zip archive.
 //
 // io.EOF is returned when the end of the zip file has been reached.
 // If Next is called again, it will presume another zip file immediately follows
-// and it will advance into it.
+// and it will advance into it. See NextArchive and SetConcatenated for
+// streams of several archives.
 func (r *Reader) Next() (*zip.FileHeader, error) {
-	if r.Reader != nil {
-		if _, err := io.Copy(ioutil.Discard, r.Reader); err != nil {
+	r.unsupported = false
+	if r.Reader != nil && r.seekable != nil {
+		// The next entry is read from its own offset.
+		r.closeEntry()
+	} else if r.Reader != nil {
+		_, err := io.Copy(ioutil.Discard, r.Reader)
+		damaged := r.damaged()
+		r.closeEntry()
+		if err != nil && !damaged {
 			return nil, err
 		}
 	}
+	if r.seekable != nil {
+		return r.nextSeekable()
+	}
+	if r.pipeline != nil && r.salvage == nil && r.limits == nil {
+		return r.nextPipelined()
+	}
+	e, err := r.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.openEntry(e); err != nil {
+		return nil, err
+	}
+	return e.FileHeader, nil
+}
+
+// readHeader advances to the next local file header and reads it. At the
+// end of the archive it reads the central directory and returns io.EOF.
+func (r *Reader) readHeader() (*Entry, error) {
+	start := r.offset()
 LOOP:
 	for true {
 		sigBytes, err := r.br.Peek(4)
 		if err != nil {
+			r.skipped(start)
 			return nil, err
 		}
 
 		switch sig := binary.LittleEndian.Uint32(sigBytes); sig {
 		case fileHeaderSignature:
-			break LOOP
+			if r.salvage == nil || r.plausibleHeader() {
+				break LOOP
+			}
+			r.br.Discard(1)
+		case spanningSignature, tempSpanningSignature:
+			if r.offset() != 0 {
+				r.br.Discard(1)
+				continue
+			}
+			// Marks the first volume of a split archive
+			r.br.Discard(4)
+			start = r.offset()
 		case directoryHeaderSignature: // Directory appears at end of file so we are finished
-			return nil, discardCentralDirectory(r.br)
+			r.skipped(start)
+			err := r.readCentralDirectory()
+			if r.recoverDirectory(err) {
+				if !r.ended {
+					start = r.offset()
+					continue
+				}
+				// Read in full, so the archive ends all the same
+				err = io.EOF
+			}
+			if err != io.EOF || !r.concatenated {
+				return nil, err
+			}
+			start = r.offset()
 		default:
 			// Advance the reader to componesate for non-zip related stuff
 			r.br.Discard(1)
 		}
 	}
+	r.skipped(start)
 
-	f, err := readFileHeader(r.br)
+	headerOffset := r.offset()
+	e, err := readFileHeader(r.br)
 	if err != nil {
 		return nil, err
 	}
+	e.HeaderOffset = headerOffset
+	e.DataOffset = r.offset()
+	e.Archive = r.archive
+	r.ended = false
+	r.decodeName(e)
+	if r.local == nil {
+		r.local = make(map[int64]*zip.FileHeader)
+	}
+	r.local[headerOffset] = e.FileHeader
+	return e, nil
+}
 
+// decodeName decodes the name of e with the NameDecoder, if it is not
+// flagged as UTF-8.
+func (r *Reader) decodeName(e *Entry) {
+	f := e.FileHeader
+	if f.NonUTF8 && r.nameDecoder != nil {
+		if name, err := r.nameDecoder(e.RawName); err == nil {
+			f.Name = name
+			f.NonUTF8 = false
+		}
+	}
+}
+
+// openEntry makes e, whose content is next in the stream, the current entry.
+func (r *Reader) openEntry(e *Entry) error {
+	r.entry = e
+	f := e.FileHeader
 	dcomp := r.decompressor(f.Method)
 	if dcomp == nil {
-		return nil, zip.ErrAlgorithm
+		r.unsupported = true
+		return zip.ErrAlgorithm
 	}
 
-	crc := &crcReader{
-		hash: crc32.NewIEEE(),
-		crc:  &f.CRC32,
+	limits := r.limits
+	if r.unlimited != nil && r.unlimited(e) {
+		limits = nil
 	}
-	if f.Flags&0x8 != 0 { // If has dataDescriptor
-		crc.Reader = dcomp(&descriptorReader{br: r.br, fileHeader: f})
+	if limits != nil {
+		if err := limits.open(f, e.DataDescriptor); err != nil {
+			return err
+		}
+	}
+
+	var raw io.Reader
+	if e.DataDescriptor && r.seekable == nil {
+		raw = &descriptorReader{br: r.br, entry: e}
 	} else {
-		crc.Reader = dcomp(io.LimitReader(r.br, int64(f.CompressedSize64)))
-		crc.crc = &f.CRC32
+		raw = io.LimitReader(r.br, int64(f.CompressedSize64))
+	}
+	if r.observer != nil {
+		r.progress = &entryProgress{observer: r.observer, header: f}
+		raw = &progressReader{Reader: raw, progress: r.progress, raw: true}
+	}
+	var counted *countReader
+	if limits != nil {
+		counted = &countReader{Reader: raw}
+		raw = counted
+	}
+	var rawDigest *digestReader
+	if len(r.rawDigests) > 0 {
+		rawDigest = newDigestReader(raw, r.rawDigests)
+		raw = rawDigest
+	}
+
+	r.raw = raw
+	r.dcomp = dcomp(raw)
+	crc := &crcReader{
+		Reader: r.dcomp,
+		hash:   crc32.NewIEEE(),
+		crc:    &f.CRC32,
 	}
 	r.Reader = crc
-	return f, nil
+	if len(r.digests) > 0 || rawDigest != nil {
+		e.digest = newDigestReader(crc, r.digests)
+		e.digest.raw = rawDigest
+		r.Reader = e.digest
+	}
+	r.Reader = r.recoverEntry(e, r.Reader)
+	if limits != nil {
+		r.Reader = &limitReader{Reader: r.Reader, limits: limits, raw: counted}
+	}
+	if r.progress != nil {
+		r.Reader = &progressReader{Reader: r.Reader, progress: r.progress}
+		r.observer.EntryStart(f)
+	}
+	return nil
 }
 
-func readFileHeader(r io.Reader) (*zip.FileHeader, error) {
+// skipped reports the bytes skipped since start to the observer.
+func (r *Reader) skipped(start int64) {
+	n := r.offset() - start
+	if r.observer != nil && n > 0 {
+		r.observer.JunkSkipped(n)
+	}
+	if r.salvage != nil {
+		r.salvage.Skipped += n
+	}
+}
+
+// closeEntry releases the decompressor of the current entry, after which
+// reading the entry returns io.EOF.
+func (r *Reader) closeEntry() {
+	if r.job != nil {
+		r.closeJob()
+	}
+	if r.dcomp != nil {
+		r.dcomp.Close()
+		r.dcomp = nil
+	}
+	if r.progress != nil {
+		r.progress.finish()
+		r.progress = nil
+	}
+	r.Reader = errReader{io.EOF}
+	r.raw = nil
+}
+
+// readFileHeader reads a local file header.
+func readFileHeader(r io.Reader) (*Entry, error) {
 	var buf [fileHeaderLen]byte
 	if _, err := io.ReadFull(r, buf[:]); err != nil {
 		return nil, err
@@ -145,9 +330,6 @@ func readFileHeader(r io.Reader) (*zip.FileHeader, error) {
 	// Best effort to find what we need.
 	// Other zip authors might not even follow the basic format,
 	// and we'll just ignore the Extra content in that case.
-	var modified time.Time
-
-parseExtras:
 	for extra := readBuf(f.Extra); len(extra) >= 4; { // need at least tag and size
 		fieldTag := extra.uint16()
 		fieldSize := int(extra.uint16())
@@ -155,66 +337,44 @@ parseExtras:
 			break
 		}
 		fieldBuf := extra.sub(fieldSize)
+		if fieldTag != zip64ExtraID {
+			continue
+		}
 
-		switch fieldTag {
-		case zip64ExtraID:
-			// update directory values from the zip64 extra block.
-			// They should only be consulted if the sizes read earlier
-			// are maxed out.
-			// See golang.org/issue/13367.
-			if needUSize {
-				needUSize = false
-				if len(fieldBuf) < 8 {
-					return nil, zip.ErrFormat
-				}
-				f.UncompressedSize64 = fieldBuf.uint64()
-			}
-			if needCSize {
-				needCSize = false
-				if len(fieldBuf) < 8 {
-					return nil, zip.ErrFormat
-				}
-				f.CompressedSize64 = fieldBuf.uint64()
-			}
-		case ntfsExtraID:
-			if len(fieldBuf) < 4 {
-				continue parseExtras
-			}
-			fieldBuf.uint32()        // reserved (ignored)
-			for len(fieldBuf) >= 4 { // need at least tag and size
-				attrTag := fieldBuf.uint16()
-				attrSize := int(fieldBuf.uint16())
-				if len(fieldBuf) < attrSize {
-					continue parseExtras
-				}
-				attrBuf := fieldBuf.sub(attrSize)
-				if attrTag != 1 || attrSize != 24 {
-					continue // Ignore irrelevant attributes
-				}
-
-				const ticksPerSecond = 1e7    // Windows timestamp resolution
-				ts := int64(attrBuf.uint64()) // ModTime since Windows epoch
-				secs := int64(ts / ticksPerSecond)
-				nsecs := (1e9 / ticksPerSecond) * int64(ts%ticksPerSecond)
-				epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
-				modified = time.Unix(epoch.Unix()+secs, nsecs)
-			}
-		case unixExtraID, infoZipUnixExtraID:
+		// update directory values from the zip64 extra block.
+		// They should only be consulted if the sizes read earlier
+		// are maxed out.
+		// See golang.org/issue/13367.
+		if needUSize {
+			needUSize = false
 			if len(fieldBuf) < 8 {
-				continue parseExtras
+				return nil, zip.ErrFormat
 			}
-			fieldBuf.uint32()              // AcTime (ignored)
-			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
-			modified = time.Unix(ts, 0)
-		case extTimeExtraID:
-			if len(fieldBuf) < 5 || fieldBuf.uint8()&1 == 0 {
-				continue parseExtras
+			f.UncompressedSize64 = fieldBuf.uint64()
+		}
+		if needCSize {
+			needCSize = false
+			if len(fieldBuf) < 8 {
+				return nil, zip.ErrFormat
 			}
-			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
-			modified = time.Unix(ts, 0)
+			f.CompressedSize64 = fieldBuf.uint64()
 		}
 	}
 
+	extras := ParseExtras(f.Extra)
+	if extras.UnixMode != 0 {
+		// Local file headers carry no creator version; mark the header
+		// as coming from a Unix system so that FileHeader.Mode reports
+		// the mode found in the extra fields.
+		f.CreatorVersion = creatorUnix<<8 | f.ReaderVersion&0xff
+		f.ExternalAttrs = extras.UnixMode << 16
+	}
+	if name, ok := unicodeValue(extras.UnicodePath, d[:filenameLen]); ok {
+		f.Name = name
+		f.NonUTF8 = false
+	}
+	modified := extras.Modified
+
 	msdosModified := msDosTimeToTime(f.ModifiedDate, f.ModifiedTime)
 	f.Modified = msdosModified
 	if !modified.IsZero() {
@@ -247,13 +407,29 @@ parseExtras:
 		return nil, zip.ErrFormat
 	}
 
-	return f, nil
+	return &Entry{
+		FileHeader:     f,
+		RawName:        d[:filenameLen],
+		Extras:         extras,
+		DataDescriptor: f.Flags&0x8 != 0,
+	}, nil
+}
+
+// unicodeValue returns the UTF-8 form of raw held in an Info-ZIP Unicode
+// Path or Comment field. The field is ignored unless it was computed from
+// raw, since a tool renaming an entry may have left a stale one behind.
+func unicodeValue(u *UnicodeField, raw []byte) (string, bool) {
+	if u == nil || u.Version != 1 || crc32.ChecksumIEEE(raw) != u.CRC32 ||
+		!utf8.ValidString(u.Value) {
+		return "", false
+	}
+	return u.Value, true
 }
 
 // Buffered returns any bytes beyond the end of the zip file that it may have
 // read. These are necessary if you plan to process anything after it,
-// that isn't another zip file.
-func (r *Reader) Buffered() io.Reader { return r.br }
+// that isn't another zip file. The returned reader implements io.WriterTo.
+func (r *Reader) Buffered() io.Reader { return remainder{r.br, r.src} }
 
 // RegisterDecompressor registers or overrides a custom decompressor for a
 // specific method ID. If a decompressor for a given method is not found,
@@ -2,6 +2,8 @@ package zipstream
 
 import (
 	"bytes"
+	"encoding/binary"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -130,3 +132,37 @@ func TestHeaderShortRead(t *testing.T) {
 		}
 	}
 }
+
+func TestUnicodePath(t *testing.T) {
+	raw := "\x81ber.txt" // "über.txt" in CP437
+	unicodePath := func(crc uint32) []byte {
+		data := []byte{1, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(data[1:], crc)
+		return extraField(unicodePathExtraID, append(data, "über.txt"...)...)
+	}
+	tests := []struct {
+		extra   []byte
+		name    string
+		nonUTF8 bool
+	}{
+		{unicodePath(crc32.ChecksumIEEE([]byte(raw))), "über.txt", false},
+		{unicodePath(0), raw, true}, // stale field
+		{nil, raw, true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		if _, err := zw.CreateHeader(&zip.FileHeader{Name: raw, NonUTF8: true, Extra: tt.extra}); err != nil {
+			t.Fatal(err)
+		}
+		zw.Close()
+
+		h, err := NewReader(&buf).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != tt.name || h.NonUTF8 != tt.nonUTF8 {
+			t.Errorf("Name, NonUTF8 = %q, %v, want %q, %v", h.Name, h.NonUTF8, tt.name, tt.nonUTF8)
+		}
+	}
+}
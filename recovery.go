@@ -0,0 +1,215 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// A Salvage summarises what a Reader in recovery mode got out of a stream.
+type Salvage struct {
+	// Entries are all the entries returned by Next.
+	Entries []*Entry
+
+	// Truncated is the entry cut short by the end of the stream, if any.
+	Truncated *Entry
+
+	// Damaged are the entries whose content failed to decompress or
+	// verify while the stream went on.
+	Damaged []*Entry
+
+	// Skipped is the number of bytes skipped to find the next header,
+	// including those of headers that did not look genuine.
+	Skipped int64
+
+	// Errors are the errors the damaged entries failed with, followed by
+	// those of central directories that could not be read, in the order
+	// they were met.
+	Errors []error
+}
+
+// SetRecovery sets whether r reads damaged and truncated archives as far
+// as it can, rather than failing at the first error.
+//
+// In recovery mode, local file headers are only accepted when plausible,
+// and Next skips to the next one after an entry or central directory that
+// cannot be read; reading a damaged entry still returns its error. When
+// the stream ends in the middle of an entry, reading it returns what there
+// is followed by io.EOF, and sets Entry.Truncated. Salvage reports what
+// was recovered. Entries are read one at a time, whatever SetConcurrency
+// was given.
+//
+// SetRecovery must be called before the first call to Next.
+func (r *Reader) SetRecovery(on bool) {
+	if !on {
+		r.salvage = nil
+	} else if r.salvage == nil {
+		r.salvage = new(Salvage)
+	}
+}
+
+// Salvage returns the summary of what was recovered so far, or nil if r is
+// not in recovery mode.
+func (r *Reader) Salvage() *Salvage {
+	return r.salvage
+}
+
+// recoverEntry wraps the content of e, if in recovery mode.
+func (r *Reader) recoverEntry(e *Entry, content io.Reader) io.Reader {
+	if r.salvage == nil {
+		return content
+	}
+	r.salvage.Entries = append(r.salvage.Entries, e)
+	return &recoveryReader{Reader: content, r: r, entry: e}
+}
+
+// recoveryReader tells an entry cut short by the end of the stream from
+// a damaged one, when reading its content fails.
+type recoveryReader struct {
+	io.Reader
+	r     *Reader
+	entry *Entry
+}
+
+func (rr *recoveryReader) Read(p []byte) (int, error) {
+	n, err := rr.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = rr.failed(err)
+	}
+	return n, err
+}
+
+func (rr *recoveryReader) WriteTo(w io.Writer) (int64, error) {
+	ew := &errWriter{w: w}
+	n, err := copyBuffer(ew, rr.Reader)
+	if err != nil && err != ew.err {
+		err = rr.failed(err)
+	}
+	return n, err
+}
+
+// failed records the error reading the entry failed with, and returns
+// io.EOF if that was due to the end of the stream.
+func (rr *recoveryReader) failed(err error) error {
+	s := rr.r.salvage
+	switch ended := rr.r.streamEnded(); {
+	case ended && rr.r.truncated(rr.entry, err):
+		rr.entry.Truncated = true
+		s.Truncated = rr.entry
+		return io.EOF
+	case !ended && rr.r.src.err != nil:
+		// The stream failed; there is nothing to recover from.
+		return err
+	}
+	if n := len(s.Damaged); n == 0 || s.Damaged[n-1] != rr.entry {
+		s.Damaged = append(s.Damaged, rr.entry)
+		s.Errors = append(s.Errors, err)
+	}
+	return err
+}
+
+// streamEnded reports whether nothing is left in the stream beyond what is
+// buffered.
+func (r *Reader) streamEnded() bool {
+	n := r.br.Buffered()
+	if n == r.br.Size() {
+		return false
+	}
+	_, err := r.br.Peek(n + 1)
+	return err == io.EOF
+}
+
+// truncated reports whether reading e failed with err because the stream,
+// which has ended, ends before the content of e.
+func (r *Reader) truncated(e *Entry, err error) bool {
+	if e.DataDescriptor {
+		return err == io.ErrUnexpectedEOF
+	}
+	end := r.offset() + int64(r.br.Buffered())
+	return e.DataOffset+int64(e.CompressedSize64) > end
+}
+
+// damaged reports whether the current entry is known to be damaged, in
+// which case Next moves on to the next header rather than fail.
+func (r *Reader) damaged() bool {
+	if r.salvage == nil {
+		return false
+	}
+	n := len(r.salvage.Damaged)
+	return n > 0 && r.salvage.Damaged[n-1] == r.entry
+}
+
+// errWriter records the error of a write.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// plausibleHeader reports whether the local file header at the start of
+// the buffer looks genuine rather than like a signature found by chance
+// in damaged data.
+func (r *Reader) plausibleHeader() bool {
+	b, err := r.br.Peek(fileHeaderLen)
+	if err != nil {
+		return false
+	}
+	n := fileHeaderLen + int(binary.LittleEndian.Uint16(b[26:])) + int(binary.LittleEndian.Uint16(b[28:]))
+	if n > r.br.Size() {
+		return false
+	}
+	if b, err = r.br.Peek(n); err != nil {
+		return false
+	}
+	e, err := readFileHeader(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+
+	f := e.FileHeader
+	if f.ReaderVersion&0xff > 63 { // 6.3 is the latest version of the format
+		return false
+	}
+	if m := f.Method; m > 20 && (m < 93 || m > 99) && r.decompressor(m) == nil {
+		return false
+	}
+	if d := f.ModifiedDate; d != 0 {
+		if month, day := d>>5&0xf, d&0x1f; month < 1 || month > 12 || day < 1 {
+			return false
+		}
+	}
+	if bytes.IndexByte(e.RawName, 0) >= 0 {
+		return false
+	}
+	// The extra fields have to fill the extra data exactly.
+	for extra := readBuf(f.Extra); len(extra) > 0; {
+		if len(extra) < 4 {
+			// Padding left by some aligning tools
+			return bytes.Count(extra, []byte{0}) == len(extra)
+		}
+		extra.uint16()
+		size := int(extra.uint16())
+		if len(extra) < size {
+			return false
+		}
+		extra.sub(size)
+	}
+	return true
+}
+
+// recoverDirectory records the error a central directory could not be
+// read with, and reports whether to go on looking for headers.
+func (r *Reader) recoverDirectory(err error) bool {
+	if r.salvage == nil || err == io.EOF || r.src.err != nil {
+		return false
+	}
+	r.salvage.Errors = append(r.salvage.Errors, err)
+	return true
+}
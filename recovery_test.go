@@ -0,0 +1,121 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func recoveryZip(t *testing.T, descriptor bool) ([]byte, [][]byte) {
+	contents := [][]byte{
+		bytes.Repeat([]byte("first entry "), 1000),
+		bytes.Repeat([]byte("second entry, to be damaged "), 1000),
+		bytes.Repeat([]byte("third entry "), 1000),
+	}
+	var entries []testEntry
+	for i, content := range contents {
+		e := deflated(string(rune('a'+i)), string(content))
+		e.sized = !descriptor
+		entries = append(entries, e)
+	}
+	return testZip(t, "", entries...), contents
+}
+
+// readRecovered reads every entry of z in recovery mode, returning their
+// contents and the errors reading them failed with.
+func readRecovered(t *testing.T, z []byte) (*Reader, [][]byte, []error) {
+	r := NewReader(bytes.NewReader(z))
+	r.SetRecovery(true)
+	var contents [][]byte
+	var errs []error
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			return r, contents, errs
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		contents = append(contents, b)
+		errs = append(errs, err)
+	}
+}
+
+func TestRecoveryTruncated(t *testing.T) {
+	for _, descriptor := range []bool{false, true} {
+		z, want := recoveryZip(t, descriptor)
+		second := bytes.Index(z[4:], []byte{0x50, 0x4b, 0x03, 0x04}) + 4
+		cut := second + fileHeaderLen + 1 + 100
+
+		r, contents, errs := readRecovered(t, z[:cut])
+		if len(contents) != 2 {
+			t.Fatalf("descriptor %v: read %d entries, want 2", descriptor, len(contents))
+		}
+		if errs[0] != nil || !bytes.Equal(contents[0], want[0]) {
+			t.Errorf("descriptor %v: first entry not read in full: %v", descriptor, errs[0])
+		}
+		if errs[1] != nil || !bytes.HasPrefix(want[1], contents[1]) {
+			t.Errorf("descriptor %v: truncated entry: %d bytes, %v", descriptor, len(contents[1]), errs[1])
+		}
+		s := r.Salvage()
+		if len(s.Entries) != 2 || s.Truncated != s.Entries[1] || !s.Entries[1].Truncated || s.Entries[0].Truncated {
+			t.Errorf("descriptor %v: salvage %+v", descriptor, s)
+		}
+	}
+}
+
+func TestRecoveryDamaged(t *testing.T) {
+	z, want := recoveryZip(t, false)
+	second := bytes.Index(z[4:], []byte{0x50, 0x4b, 0x03, 0x04}) + 4
+	for i := second + fileHeaderLen + 1 + 10; i < second+fileHeaderLen+1+40; i++ {
+		z[i] ^= 0x55
+	}
+	// Junk, with something like a header, before the archive.
+	junk := append([]byte{0x50, 0x4b, 0x03, 0x04}, bytes.Repeat([]byte{0xff}, 40)...)
+	z = append(junk, z...)
+
+	r, contents, errs := readRecovered(t, z)
+	if len(contents) != 3 {
+		t.Fatalf("read %d entries, want 3", len(contents))
+	}
+	if errs[1] == nil {
+		t.Error("damaged entry read without error")
+	}
+	for _, i := range []int{0, 2} {
+		if errs[i] != nil || !bytes.Equal(contents[i], want[i]) {
+			t.Errorf("entry %d: %v", i, errs[i])
+		}
+	}
+	s := r.Salvage()
+	if len(s.Damaged) != 1 || s.Damaged[0] != s.Entries[1] || len(s.Errors) != 1 || s.Truncated != nil {
+		t.Errorf("salvage %+v", s)
+	}
+	if s.Skipped != int64(len(junk)) {
+		t.Errorf("skipped %d bytes, want %d", s.Skipped, len(junk))
+	}
+}
+
+func TestRecoveryDirectory(t *testing.T) {
+	z, _ := recoveryZip(t, true)
+	dir := bytes.Index(z, []byte{0x50, 0x4b, 0x01, 0x02})
+	z[dir+directoryHeaderLen+1] = 0 // Signature of the second record
+
+	r, contents, _ := readRecovered(t, z)
+	if len(contents) != 3 {
+		t.Fatalf("read %d entries, want 3", len(contents))
+	}
+	if s := r.Salvage(); len(s.Errors) != 1 || len(s.Damaged) != 0 {
+		t.Errorf("salvage %+v", s)
+	}
+
+	// Without recovery, the directory fails.
+	r = NewReader(bytes.NewReader(z))
+	err := r.Walk(func(*Entry, io.Reader) error { return nil })
+	if err != zip.ErrFormat {
+		t.Errorf("Walk = %v, want %v", err, zip.ErrFormat)
+	}
+}
@@ -0,0 +1,86 @@
+package zipstream
+
+import (
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// A State is what a Reader needs to resume reading a stream at the local
+// file header of an entry, for example after the process reading it was
+// restarted. It can be saved as JSON.
+type State struct {
+	// Offset is the position in the stream to resume at.
+	Offset int64
+
+	// Archive is the index of the archive at Offset.
+	Archive int
+
+	// Entries are the entries of that archive before Offset, so that the
+	// central directory can be checked against them.
+	Entries []EntryRecord
+}
+
+// An EntryRecord describes an entry read before a State was taken.
+type EntryRecord struct {
+	Offset             int64 // of the local file header
+	Name               string
+	CRC32              uint32
+	CompressedSize64   uint64
+	UncompressedSize64 uint64
+}
+
+// State returns the state to resume reading the stream at the current
+// entry, which will be read again, or once Next has returned io.EOF, at
+// whatever follows the archive.
+func (r *Reader) State() *State {
+	s := &State{Offset: r.offset(), Archive: r.archive}
+	if r.entry != nil && r.entry.Archive == r.archive && !r.ended {
+		s.Offset = r.entry.HeaderOffset
+		s.Archive = r.entry.Archive
+	}
+	for offset, f := range r.local {
+		if offset < s.Offset {
+			s.Entries = append(s.Entries, EntryRecord{
+				Offset:             offset,
+				Name:               f.Name,
+				CRC32:              f.CRC32,
+				CompressedSize64:   f.CompressedSize64,
+				UncompressedSize64: f.UncompressedSize64,
+			})
+		}
+	}
+	sort.Slice(s.Entries, func(i, j int) bool { return s.Entries[i].Offset < s.Entries[j].Offset })
+	return s
+}
+
+// NewReaderAt creates a new Reader reading from r, which holds the stream
+// from startOffset on, as returned by State. Offsets, such as those of
+// Entry, are positions in the whole stream.
+//
+// The entries of state before startOffset are taken as read, so that they
+// are not reported missing from the central directory; state may be nil.
+func NewReaderAt(r io.Reader, startOffset int64, state *State) *Reader {
+	zr := NewReader(r)
+	zr.src.n = startOffset
+	if state == nil {
+		return zr
+	}
+	zr.archive = state.Archive
+	for _, rec := range state.Entries {
+		if rec.Offset >= startOffset {
+			continue
+		}
+		if zr.local == nil {
+			zr.local = make(map[int64]*zip.FileHeader)
+		}
+		zr.local[rec.Offset] = &zip.FileHeader{
+			Name:               rec.Name,
+			CRC32:              rec.CRC32,
+			CompressedSize64:   rec.CompressedSize64,
+			UncompressedSize64: rec.UncompressedSize64,
+		}
+	}
+	return zr
+}
@@ -0,0 +1,92 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func resumeZip(t *testing.T) []byte {
+	var entries []testEntry
+	for i := 0; i < 5; i++ {
+		e := deflated(fmt.Sprint(i), strings.Repeat(fmt.Sprint(i), 5000))
+		e.h.Comment = "comment"
+		entries = append(entries, e)
+	}
+	return testZip(t, "junk", entries...)
+}
+
+func TestResume(t *testing.T) {
+	z := resumeZip(t)
+	r := NewReader(bytes.NewReader(z))
+	for i := 0; i < 3; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Crash in the middle of the third entry.
+	if _, err := r.Read(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(r.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Entries) != 2 || state.Offset != r.Entry().HeaderOffset {
+		t.Fatalf("state %+v, want two entries before %d", state, r.Entry().HeaderOffset)
+	}
+
+	r = NewReaderAt(bytes.NewReader(z[state.Offset:]), state.Offset, &state)
+	var names string
+	var headers []*zip.FileHeader
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+		names += h.Name
+		headers = append(headers, h)
+	}
+	for _, h := range headers {
+		if h.Comment != "comment" {
+			t.Errorf("%s: comment %q from the central directory", h.Name, h.Comment)
+		}
+	}
+	if names != "234" {
+		t.Errorf("resumed with %q, want %q", names, "234")
+	}
+	if d := r.Directory(); len(d.Missing) != 0 || d.ArchiveOffset != 4 {
+		t.Errorf("directory with %d entries missing at offset %d", len(d.Missing), d.ArchiveOffset)
+	}
+
+	// Without the state, the entries before are missing.
+	r = NewReaderAt(bytes.NewReader(z[state.Offset:]), state.Offset, nil)
+	if err := r.Walk(func(*Entry, io.Reader) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if d := r.Directory(); len(d.Missing) != 2 {
+		t.Errorf("%d entries missing, want 2", len(d.Missing))
+	}
+
+	// Once the archive is read, the state resumes after it.
+	if s := r.State(); s.Offset != int64(len(z)) || s.Archive != 1 || len(s.Entries) != 0 {
+		t.Errorf("state at the end %+v, want offset %d in archive 1", s, len(z))
+	}
+}
@@ -0,0 +1,186 @@
+package zipstream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// maxDirectoryEndLen is the farthest from the end of the archive the end of
+// central directory record can start: with the longest comment.
+const maxDirectoryEndLen = directoryEndLen + 0xffff
+
+// seekable is the state of a Reader created by NewSeekableReader.
+type seekable struct {
+	ra      io.ReaderAt
+	records []*directoryRecord
+	ends    []int64 // offset past the last byte of every entry
+	next    int     // index in records of the next entry
+}
+
+// NewSeekableReader creates a Reader of the archive held by ra, which is
+// size bytes long, such as a file or an object that can be read in ranges.
+//
+// Rather than reading the archive from the start, it reads the central
+// directory at the end first and then reads the entries in its order,
+// from the offsets it gives. The Reader is used as any other: Next
+// returns the entries, with the attributes stored in the central
+// directory already filled in, and io.EOF after the last one. Entries
+// that are skipped are not read at all, so their CRC-32 is not checked.
+// Directory is available from the start; the read-ahead of
+// SetConcurrency and the options for streams of several archives do not
+// apply.
+func NewSeekableReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	start, base, err := findDirectory(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	d, err := readCentralDirectory(bufio.NewReader(io.NewSectionReader(ra, start, size-start)))
+	if err != io.EOF {
+		if err == nil {
+			err = zip.ErrFormat
+		}
+		return nil, err
+	}
+
+	s := &seekable{ra: ra, records: d.records, ends: make([]int64, len(d.records))}
+	dir := &Directory{
+		Offset:        start,
+		ArchiveOffset: base,
+		Files:         make([]*zip.FileHeader, len(d.records)),
+		Comment:       d.comment,
+		offsets:       make([]int64, len(d.records)),
+	}
+	offsets := []int64{start}
+	for i, rec := range d.records {
+		rec.headerOffset += base
+		if rec.headerOffset < 0 || rec.headerOffset >= start {
+			return nil, zip.ErrFormat
+		}
+		offsets = append(offsets, rec.headerOffset)
+		dir.Files[i] = &rec.FileHeader
+		dir.offsets[i] = rec.headerOffset
+	}
+	// An entry ends where the next one in the archive starts.
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for i, rec := range d.records {
+		s.ends[i] = offsets[sort.Search(len(offsets), func(j int) bool { return offsets[j] > rec.headerOffset })]
+	}
+
+	r := NewReader(nil)
+	r.seekable = s
+	r.directory = dir
+	return r, nil
+}
+
+// findDirectory returns the offset of the central directory of the archive
+// held by ra, and that of the start of the archive.
+func findDirectory(ra io.ReaderAt, size int64) (start, base int64, err error) {
+	n := int64(maxDirectoryEndLen)
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := ra.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+	p := -1
+	for i := len(buf) - directoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) == directoryEndSignature &&
+			i+directoryEndLen+int(binary.LittleEndian.Uint16(buf[i+20:])) <= len(buf) {
+			p = i
+			break
+		}
+	}
+	if p < 0 {
+		return 0, 0, zip.ErrFormat
+	}
+	end := size - n + int64(p)
+	dirSize := int64(binary.LittleEndian.Uint32(buf[p+12:]))
+	dirOffset := int64(binary.LittleEndian.Uint32(buf[p+16:]))
+
+	// With zip64, the locator precedes the end record and gives the
+	// offset of the zip64 end record.
+	if p >= 20 && binary.LittleEndian.Uint32(buf[p-20:]) == directory64LocSignature {
+		end64 := int64(binary.LittleEndian.Uint64(buf[p-12:]))
+		var b [56]byte
+		if end64 < 0 || end64 > size-56 {
+			end64 = end - 20 - 56
+		}
+		if _, err := ra.ReadAt(b[:], end64); err != nil {
+			return 0, 0, err
+		}
+		if binary.LittleEndian.Uint32(b[:]) != directory64EndSignature {
+			// Offset relative to an archive that does not start the file
+			if end64 = end - 20 - 56; end64 < 0 {
+				return 0, 0, zip.ErrFormat
+			}
+			if _, err := ra.ReadAt(b[:], end64); err != nil {
+				return 0, 0, err
+			}
+			if binary.LittleEndian.Uint32(b[:]) != directory64EndSignature {
+				return 0, 0, zip.ErrFormat
+			}
+		}
+		end = end64
+		dirSize = int64(binary.LittleEndian.Uint64(b[40:]))
+		dirOffset = int64(binary.LittleEndian.Uint64(b[48:]))
+	}
+
+	// Anything before the archive, such as the stub of a self-extracting
+	// archive, shifts every offset.
+	start = end - dirSize
+	base = start - dirOffset
+	if start < 0 || base < 0 {
+		return 0, 0, zip.ErrFormat
+	}
+	return start, base, nil
+}
+
+// nextSeekable reads the local file header of the next entry of the
+// central directory, and opens it.
+func (r *Reader) nextSeekable() (*zip.FileHeader, error) {
+	s := r.seekable
+	if s.next == len(s.records) {
+		r.ended = true
+		return nil, io.EOF
+	}
+	rec := s.records[s.next]
+	end := s.ends[s.next]
+	s.next++
+
+	offset := rec.headerOffset
+	r.src.r = io.NewSectionReader(s.ra, offset, end-offset)
+	r.src.n = offset
+	r.br.Reset(r.src)
+	e, err := readFileHeader(r.br)
+	if err != nil {
+		return nil, err
+	}
+	e.HeaderOffset = offset
+	e.DataOffset = r.offset()
+	e.Archive = r.archive
+	r.decodeName(e)
+
+	f := e.FileHeader
+	f.CreatorVersion = rec.CreatorVersion
+	f.ExternalAttrs = rec.ExternalAttrs
+	f.Comment = rec.Comment
+	if e.DataDescriptor {
+		f.CRC32 = rec.CRC32
+		f.CompressedSize = rec.CompressedSize
+		f.UncompressedSize = rec.UncompressedSize
+		f.CompressedSize64 = rec.CompressedSize64
+		f.UncompressedSize64 = rec.UncompressedSize64
+	}
+	if e.DataOffset+int64(f.CompressedSize64) > end {
+		return nil, zip.ErrFormat
+	}
+	if err := r.openEntry(e); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
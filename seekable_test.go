@@ -0,0 +1,94 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// readAll returns the names and contents of the entries read by r.
+func readAll(t *testing.T, r *Reader) ([]string, [][]byte) {
+	var names []string
+	var contents [][]byte
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			return names, contents
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", h.Name, err)
+		}
+		names = append(names, h.Name)
+		contents = append(contents, b)
+	}
+}
+
+func TestSeekableReader(t *testing.T) {
+	for _, name := range []string{"test.zip", "dd.zip", "go-with-datadesc-sig.zip", "zip64.zip", "unix.zip", "winxp.zip"} {
+		z, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantNames, want := readAll(t, NewReader(bytes.NewReader(z)))
+		r, err := NewSeekableReader(bytes.NewReader(z), int64(len(z)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		names, contents := readAll(t, r)
+		if len(names) != len(wantNames) {
+			t.Fatalf("%s: read %q, want %q", name, names, wantNames)
+		}
+		for i := range names {
+			if names[i] != wantNames[i] || !bytes.Equal(contents[i], want[i]) {
+				t.Errorf("%s: entry %d %q differs from %q streamed", name, i, names[i], wantNames[i])
+			}
+		}
+	}
+}
+
+func TestSeekableReaderDirectory(t *testing.T) {
+	z := resumeZip(t)
+	r, err := NewSeekableReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := r.Directory()
+	if d == nil || len(d.Files) != 5 || d.ArchiveOffset != 4 {
+		t.Fatalf("directory %+v before the first entry", d)
+	}
+	for i := 0; ; i++ {
+		h, err := r.Next()
+		if err == io.EOF {
+			if i != 5 {
+				t.Errorf("read %d entries, want 5", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Entries with a data descriptor have their sizes up front.
+		if h.Comment != "comment" || h.UncompressedSize64 != 5000 {
+			t.Errorf("%s: comment %q, size %d", h.Name, h.Comment, h.UncompressedSize64)
+		}
+		if !r.Entry().DataDescriptor {
+			t.Errorf("%s: not read as an entry with a data descriptor", h.Name)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(b, bytes.Repeat([]byte(h.Name), 5000)) {
+			t.Errorf("%s: %d bytes, %v", h.Name, len(b), err)
+		}
+	}
+
+	if _, err := NewSeekableReader(bytes.NewReader(z[:len(z)-10]), int64(len(z)-10)); err != zip.ErrFormat {
+		t.Errorf("truncated archive: %v, want %v", err, zip.ErrFormat)
+	}
+}
@@ -0,0 +1,130 @@
+package zipstream
+
+import (
+	"context"
+	"io"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// source wraps the underlying stream. It counts the bytes read from it and,
+// while a context is set, abandons reads that outlive the context.
+type source struct {
+	r   io.Reader
+	n   int64
+	ctx context.Context
+	buf []byte
+	err error // sticky, set once a read was abandoned
+
+	observer Observer
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func (s *source) Read(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.ctx == nil || s.ctx.Done() == nil {
+		n, err = s.r.Read(p)
+	} else {
+		n, err = s.readContext(p)
+	}
+	s.n += int64(n)
+	if s.observer != nil && n > 0 {
+		s.observer.StreamRead(n)
+	}
+	return
+}
+
+// readContext reads on another goroutine so that the read can be abandoned
+// when the context is done. Since the read may still complete afterwards,
+// it reads into a buffer of its own and the source fails from then on.
+func (s *source) readContext(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return 0, err
+	}
+	if cap(s.buf) < len(p) {
+		s.buf = make([]byte, len(p))
+	}
+	buf := s.buf[:len(p)]
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := s.r.Read(buf)
+		done <- readResult{n, err}
+	}()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+		return 0, s.err
+	}
+}
+
+// errReader is the entry of a Reader whose source failed for good.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// NextContext is like Next, but returns ctx.Err() as soon as ctx is done
+// even if the underlying stream is stalled.
+//
+// A Reader that was cancelled cannot be used any further: the position in
+// the stream is lost, and every later call fails with the same error.
+func (r *Reader) NextContext(ctx context.Context) (*zip.FileHeader, error) {
+	r.src.ctx = ctx
+	f, err := r.Next()
+	r.src.ctx = nil
+	if err != nil && r.cancelled() {
+		return nil, r.src.err
+	}
+	return f, err
+}
+
+// ReaderContext returns a reader of the current entry that returns
+// ctx.Err() as soon as ctx is done, with the same consequences as for
+// NextContext.
+func (r *Reader) ReaderContext(ctx context.Context) io.Reader {
+	return &contextReader{r: r, ctx: ctx}
+}
+
+type contextReader struct {
+	r   *Reader
+	ctx context.Context
+}
+
+func (c *contextReader) Read(p []byte) (n int, err error) {
+	c.r.src.ctx = c.ctx
+	n, err = c.r.Read(p)
+	c.r.src.ctx = nil
+	if err != nil && c.r.cancelled() {
+		return n, c.r.src.err
+	}
+	return
+}
+
+func (c *contextReader) WriteTo(w io.Writer) (n int64, err error) {
+	c.r.src.ctx = c.ctx
+	n, err = c.r.WriteTo(w)
+	c.r.src.ctx = nil
+	if err != nil && c.r.cancelled() {
+		return n, c.r.src.err
+	}
+	return
+}
+
+// cancelled reports whether a read of the source was abandoned, in which
+// case the current entry is released for good.
+func (r *Reader) cancelled() bool {
+	if r.src.err == nil {
+		return false
+	}
+	r.closeEntry()
+	r.Reader = errReader{r.src.err}
+	return true
+}
@@ -0,0 +1,49 @@
+package zipstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextContext(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	r := NewReader(pr)
+	if _, err := r.NextContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("NextContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := r.Next(); err != context.DeadlineExceeded {
+		t.Fatalf("Next after cancellation = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReaderContext(t *testing.T) {
+	buf := bytes.NewBuffer(testZip(t, "", deflated("file", strings.Repeat("data", 100000))))
+
+	// Stall the stream half way through the entry.
+	pr, pw := io.Pipe()
+	go pw.Write(buf.Bytes()[:buf.Len()/2])
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewReader(pr)
+	if _, err := r.NextContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := io.Copy(ioutil.Discard, r.ReaderContext(ctx)); err != context.Canceled {
+		t.Fatalf("Copy = %v, want %v", err, context.Canceled)
+	}
+	if r.dcomp != nil {
+		t.Error("decompressor not released after cancellation")
+	}
+}
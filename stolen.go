@@ -49,6 +49,9 @@ const (
 	unixExtraID        = 0x000d // UNIX
 	extTimeExtraID     = 0x5455 // Extended timestamp
 	infoZipUnixExtraID = 0x5855 // Info-ZIP Unix extension
+
+	// Constants for the first byte in CreatorVersion.
+	creatorUnix = 3
 )
 
 // msDosTimeToTime converts an MS-DOS date and time into a time.Time.
@@ -119,6 +122,16 @@ func (r *pooledFlateReader) Read(p []byte) (n int, err error) {
 	return r.fr.Read(p)
 }
 
+// WriteTo lets io.Copy write straight from the window of the decompressor.
+func (r *pooledFlateReader) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fr == nil {
+		return 0, errors.New("Read after Close")
+	}
+	return copyBuffer(w, r.fr)
+}
+
 func (r *pooledFlateReader) Close() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
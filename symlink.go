@@ -0,0 +1,52 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// maxLinkTarget is the longest symbolic link target that will be read.
+const maxLinkTarget = 4096
+
+// ErrLinkTarget is returned when a symbolic link target is implausibly long.
+var ErrLinkTarget = errors.New("zipstream: symbolic link target too long")
+
+// IsSymlink reports whether h describes a symbolic link.
+//
+// Most archivers record the file mode only in the central directory, which
+// comes after all entries in the stream. For headers returned by Reader.Next
+// the answer is therefore only final once Next has returned io.EOF for the
+// archive; the Reader fills in the mode of every header it returned when it
+// reads the central directory.
+func IsSymlink(h *zip.FileHeader) bool {
+	return h.Mode()&os.ModeSymlink != 0
+}
+
+// modeKnown reports whether h carries a file mode, which is never the case
+// for a local file header without a mode in its extra fields.
+func modeKnown(h *zip.FileHeader) bool {
+	return h.CreatorVersion>>8 != 0 || h.ExternalAttrs != 0
+}
+
+// LinkTarget reads the rest of the current entry and returns it as the
+// target of a symbolic link. It is meant for entries for which IsSymlink
+// reports true, but since the mode may not be known yet it can be called
+// for any entry; ErrLinkTarget is returned for content that is too long to
+// be a link target.
+func (r *Reader) LinkTarget() (string, error) {
+	if r.Reader == nil {
+		return "", io.EOF
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxLinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxLinkTarget {
+		return "", ErrLinkTarget
+	}
+	return string(b), nil
+}
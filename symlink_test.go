@@ -0,0 +1,128 @@
+package zipstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+func TestSymlinkFromCentralDirectory(t *testing.T) {
+	f, err := os.Open("testdata/symlink.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := NewReader(f)
+	h, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsSymlink(h) {
+		t.Fatal("mode known before the central directory was read")
+	}
+	target, err := r.LinkTarget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../target" {
+		t.Fatalf("target = %q, want %q", target, "../target")
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Next = %v, want io.EOF", err)
+	}
+	if !IsSymlink(h) {
+		t.Fatalf("mode = %v after reading the central directory, want a symlink", h.Mode())
+	}
+}
+
+func symlinkZip(t *testing.T, target string) []byte {
+	link := testEntry{h: zip.FileHeader{Name: "dir/link"}, content: target}
+	link.h.SetMode(os.ModeSymlink | 0777)
+	return testZip(t, "", deflated("dir/file", "content"), link)
+}
+
+func TestExtractSymlinkPolicy(t *testing.T) {
+	tests := []struct {
+		policy SymlinkPolicy
+		target string
+		err    error
+		check  func(t *testing.T, link string)
+	}{
+		{SymlinkSkip, "file", nil, func(t *testing.T, link string) {
+			if _, err := os.Lstat(link); !os.IsNotExist(err) {
+				t.Errorf("Lstat = %v, want not exist", err)
+			}
+		}},
+		{SymlinkAsFile, "file", nil, func(t *testing.T, link string) {
+			b, err := ioutil.ReadFile(link)
+			if err != nil || string(b) != "file" {
+				t.Errorf("ReadFile = %q, %v, want %q", b, err, "file")
+			}
+		}},
+		{SymlinkCreate, "file", nil, func(t *testing.T, link string) {
+			b, err := ioutil.ReadFile(link)
+			if err != nil || string(b) != "content" {
+				t.Errorf("ReadFile through link = %q, %v, want %q", b, err, "content")
+			}
+		}},
+		{SymlinkCreate, "../../outside", ErrInsecurePath, nil},
+		{SymlinkCreate, strings.Repeat("x", maxLinkTarget+1), ErrLinkTarget, nil},
+		{SymlinkError, "file", ErrSymlink, nil},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		x := &Extractor{Dir: dir, Symlinks: tt.policy}
+		err := x.Extract(NewReader(bytes.NewReader(symlinkZip(t, tt.target))))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("policy %d, target %q: Extract = %v, want %v", tt.policy, tt.target, err, tt.err)
+			continue
+		}
+		if tt.check != nil {
+			tt.check(t, filepath.Join(dir, "dir", "link"))
+		}
+	}
+}
+
+func TestExtractInsecurePath(t *testing.T) {
+	z := testZip(t, "", deflated("../evil", ""))
+	x := &Extractor{Dir: t.TempDir()}
+	if err := x.Extract(NewReader(bytes.NewReader(z))); !errors.Is(err, ErrInsecurePath) {
+		t.Fatalf("Extract = %v, want ErrInsecurePath", err)
+	}
+}
+
+func TestExtractSymlinkChain(t *testing.T) {
+	link := func(name, target string) testEntry {
+		// With its mode in an ASi Unix field, so that it is known from
+		// the local file header.
+		e := testEntry{h: zip.FileHeader{Name: name, Extra: []byte{0x6e, 0x75, 14, 0, 0, 0, 0, 0, 0xff, 0xa1, 0, 0, 0, 0, 0, 0, 0, 0}}, content: target}
+		e.h.SetMode(os.ModeSymlink | 0777)
+		return e
+	}
+	for _, test := range [][][2]string{
+		// A link placed in another link
+		{{"a/b/d", "../../c"}, {"a/b/d/l", "../../../escape"}},
+		// A target going through another link, created before or after it
+		{{"p/q", ".."}, {"e", "p/q/../.."}},
+		{{"e", "p/q/../.."}, {"p/q", ".."}},
+	} {
+		entries := []testEntry{deflated("c/", "")}
+		for _, l := range test {
+			entries = append(entries, link(l[0], l[1]))
+		}
+		z := testZip(t, "", entries...)
+
+		x := &Extractor{Dir: filepath.Join(t.TempDir(), "out"), Symlinks: SymlinkCreate}
+		if err := x.Extract(NewReader(bytes.NewReader(z))); !errors.Is(err, ErrInsecurePath) {
+			t.Errorf("%q: Extract = %v, want ErrInsecurePath", test, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+const (
+	// spanningSignature starts the first volume of a split archive, and
+	// tempSpanningSignature an archive written for splitting that fit in
+	// a single volume.
+	spanningSignature     = 0x08074b50
+	tempSpanningSignature = 0x30304b50
+)
+
+// ErrVolume is returned when the disk numbers of the central directory of
+// a split archive do not match the volumes read.
+var ErrVolume = errors.New("zipstream: volume does not match central directory")
+
+// A VolumeOpener opens volume n of a split archive, counting from 0. It
+// returns io.EOF if there is no volume n.
+type VolumeOpener func(n int) (io.ReadCloser, error)
+
+// NewVolumeReader creates a Reader of an archive split into volumes, given
+// in order. For an archive split by WinZip or Info-ZIP, these are name.z01,
+// name.z02, and so on, with name.zip last.
+func NewVolumeReader(volumes ...io.Reader) *Reader {
+	return NewVolumeReaderFunc(func(n int) (io.ReadCloser, error) {
+		if n >= len(volumes) {
+			return nil, io.EOF
+		}
+		return ioutil.NopCloser(volumes[n]), nil
+	})
+}
+
+// NewVolumeReaderFunc creates a Reader of an archive split into volumes,
+// which are opened with open as the stream reaches them and closed once
+// read to the end.
+//
+// Entries are read across volume boundaries as if the volumes were a
+// single stream. Once the central directory is read, the disk numbers it
+// gives for itself and for every entry are checked against the volumes the
+// entries were read from, and ErrVolume is returned by Next instead of
+// io.EOF if they do not match.
+func NewVolumeReaderFunc(open VolumeOpener) *Reader {
+	v := &volumes{open: open}
+	r := NewReader(v)
+	r.volumes = v
+	return r
+}
+
+// volumes reads volumes one after the other.
+type volumes struct {
+	open   VolumeOpener
+	cur    io.ReadCloser
+	n      int64   // bytes read from all volumes
+	starts []int64 // offset in the stream of every volume opened
+	done   bool
+}
+
+func (v *volumes) Read(p []byte) (int, error) {
+	for {
+		if v.cur == nil {
+			if v.done {
+				return 0, io.EOF
+			}
+			rc, err := v.open(len(v.starts))
+			if err != nil {
+				if err == io.EOF {
+					v.done = true
+				}
+				return 0, err
+			}
+			v.cur = rc
+			v.starts = append(v.starts, v.n)
+		}
+
+		n, err := v.cur.Read(p)
+		v.n += int64(n)
+		if err == io.EOF {
+			v.cur.Close()
+			v.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// volume returns the index of the volume holding the byte at offset.
+func (v *volumes) volume(offset int64) int {
+	return sort.Search(len(v.starts), func(i int) bool { return v.starts[i] > offset }) - 1
+}
+
+// offset returns the stream offset of the given offset in volume disk.
+func (v *volumes) offset(disk uint32, offset int64) (int64, error) {
+	if int64(disk) >= int64(len(v.starts)) {
+		return 0, ErrVolume
+	}
+	return v.starts[disk] + offset, nil
+}
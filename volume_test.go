@@ -0,0 +1,153 @@
+package zipstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// splitZip splits an archive without comment into volumes of size bytes,
+// the way WinZip does: the first volume starts with the spanning signature
+// and offsets in the central directory are relative to their volume.
+func splitZip(z []byte, size int) [][]byte {
+	le := binary.LittleEndian
+	b := append([]byte{0x50, 0x4b, 0x07, 0x08}, z...)
+	end := b[len(b)-directoryEndLen:]
+	dirSize := int(le.Uint32(end[12:]))
+	dirStart := int(le.Uint32(end[16:])) + 4
+	for p := dirStart; p < dirStart+dirSize; {
+		rec := b[p:]
+		offset := int(le.Uint32(rec[42:])) + 4
+		le.PutUint16(rec[34:], uint16(offset/size))
+		le.PutUint32(rec[42:], uint32(offset%size))
+		p += directoryHeaderLen + int(le.Uint16(rec[28:])+le.Uint16(rec[30:])+le.Uint16(rec[32:]))
+	}
+	le.PutUint16(end[4:], uint16((len(b)-1)/size))
+	le.PutUint16(end[6:], uint16(dirStart/size))
+	le.PutUint32(end[16:], uint32(dirStart%size))
+
+	var volumes [][]byte
+	for len(b) > size {
+		volumes = append(volumes, b[:size])
+		b = b[size:]
+	}
+	return append(volumes, b)
+}
+
+func volumeZip(t *testing.T) []byte {
+	var entries []testEntry
+	for i := 0; i < 5; i++ {
+		e := deflated(fmt.Sprint(i), strings.Repeat(fmt.Sprint(i), 3000))
+		e.h.SetMode(0640)
+		entries = append(entries, e)
+	}
+	sized := testEntry{h: zip.FileHeader{Name: "sized", Method: Store}, content: strings.Repeat("sized", 1000), sized: true}
+	return testZip(t, "", append(entries, sized)...)
+}
+
+func TestVolumeReader(t *testing.T) {
+	volumes := splitZip(volumeZip(t), 100)
+	var opened, closed int
+	r := NewVolumeReaderFunc(func(n int) (io.ReadCloser, error) {
+		if n >= len(volumes) {
+			return nil, io.EOF
+		}
+		opened++
+		return closer{bytes.NewReader(volumes[n]), &closed}, nil
+	})
+	o := new(countingObserver)
+	r.SetObserver(o)
+
+	var headers []*zip.FileHeader
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", h.Name, err)
+		}
+		if h.Name != "sized" && !bytes.Equal(b, bytes.Repeat([]byte(h.Name), 3000)) {
+			t.Errorf("%s: wrong content", h.Name)
+		}
+		headers = append(headers, h)
+	}
+	if len(headers) != 6 {
+		t.Fatalf("read %d entries, want 6", len(headers))
+	}
+	for _, h := range headers[:5] {
+		if h.Mode() != 0640 {
+			t.Errorf("%s: mode %v from the central directory, want %v", h.Name, h.Mode(), 0640)
+		}
+	}
+	if d := r.Directory(); len(d.Missing) != 0 {
+		t.Errorf("%d entries of the directory missing", len(d.Missing))
+	}
+	if o.junk != 0 {
+		t.Errorf("JunkSkipped total = %d, want 0", o.junk)
+	}
+	if opened != len(volumes) || closed != len(volumes) {
+		t.Errorf("%d volumes opened and %d closed, want %d", opened, closed, len(volumes))
+	}
+}
+
+type closer struct {
+	io.Reader
+	closed *int
+}
+
+func (c closer) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestVolumeMismatch(t *testing.T) {
+	z := volumeZip(t)
+	volumes := splitZip(z, 1000)
+	// Claim the end record is on a volume before the last.
+	last := volumes[len(volumes)-1]
+	binary.LittleEndian.PutUint16(last[len(last)-directoryEndLen+4:], uint16(len(volumes)-2))
+
+	var rs []io.Reader
+	for _, v := range volumes {
+		rs = append(rs, bytes.NewReader(v))
+	}
+	r := NewVolumeReader(rs...)
+	for {
+		_, err := r.Next()
+		if err == ErrVolume {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next = %v, want %v", err, ErrVolume)
+		}
+	}
+
+	// A volume left out shifts every entry after it.
+	rs = rs[:0]
+	for i, v := range splitZip(z, 1000) {
+		if i != 1 {
+			rs = append(rs, bytes.NewReader(v))
+		}
+	}
+	r = NewVolumeReader(rs...)
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			t.Fatal("Next = io.EOF with a volume missing")
+		}
+		if err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package zipstream
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the size of the buffers used to copy content that is
+// not already held in a buffer of the decompressor.
+const copyBufferSize = 256 << 10
+
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// copyBuffer is io.Copy with a large pooled buffer. As with io.Copy, the
+// buffer is not used if src implements io.WriterTo or dst io.ReaderFrom.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	b := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(b)
+	return io.CopyBuffer(dst, src, *b)
+}
+
+// WriteTo implements io.WriterTo, writing the rest of the current entry to
+// w. It verifies the CRC-32 and computes digests in the same pass, and is
+// used by io.Copy.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	return copyBuffer(w, r.Reader)
+}
+
+// remainder reads what follows a zip file: the bytes held by the buffered
+// reader, then the rest of the stream.
+type remainder struct {
+	br  *bufio.Reader
+	src *source
+}
+
+func (b remainder) Read(p []byte) (int, error) {
+	return b.br.Read(p)
+}
+
+// WriteTo writes the buffered bytes, then copies the stream in large reads
+// rather than through the small buffer of br.
+func (b remainder) WriteTo(w io.Writer) (int64, error) {
+	buffered, _ := b.br.Peek(b.br.Buffered())
+	n, err := w.Write(buffered)
+	b.br.Discard(n)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := copyBuffer(w, b.src)
+	return int64(n) + m, err
+}
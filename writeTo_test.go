@@ -0,0 +1,78 @@
+package zipstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// writerOnly hides any io.ReaderFrom of the destination, so that io.Copy
+// has to go through WriteTo.
+type writerOnly struct{ io.Writer }
+
+func TestWriteTo(t *testing.T) {
+	content := bytes.Repeat([]byte("write me to a file "), 50000)
+
+	sized := deflated("deflate", string(content))
+	sized.sized = true
+	stored := sized
+	stored.h.Name, stored.h.Method = "store", Store
+	b := append(testZip(t, "", deflated("descriptor", string(content)), sized, stored), "trailer"...)
+
+	var _ io.WriterTo = (*Reader)(nil)
+	for _, workers := range []int{0, 2} {
+		r := NewReader(bytes.NewReader(b))
+		r.SetConcurrency(workers, 10<<20)
+		r.SetDigests(SHA256)
+		for {
+			h, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if _, err := io.Copy(writerOnly{&out}, r); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), content) {
+				t.Errorf("workers %d, %s: content does not match", workers, h.Name)
+			}
+			if sum := sha256.Sum256(content); !bytes.Equal(r.Digests()["sha256"], sum[:]) {
+				t.Errorf("workers %d, %s: wrong digest", workers, h.Name)
+			}
+		}
+
+		rest, ok := r.Buffered().(io.WriterTo)
+		if !ok {
+			t.Fatal("Buffered does not implement io.WriterTo")
+		}
+		var out bytes.Buffer
+		if _, err := rest.WriteTo(writerOnly{&out}); err != nil || out.String() != "trailer" {
+			t.Errorf("Buffered().WriteTo = %q, %v, want %q", out.String(), err, "trailer")
+		}
+	}
+}
+
+func TestWriteToChecksum(t *testing.T) {
+	e := deflated("corrupt", "corrupted content")
+	e.sized = true
+	b := testZip(t, "", e)
+	b[14] ^= 0xff // CRC-32 in the local header
+
+	for _, workers := range []int{0, 2} {
+		r := NewReader(bytes.NewReader(b))
+		r.SetConcurrency(workers, 1<<20)
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(writerOnly{ioutil.Discard}, r); err != zip.ErrChecksum {
+			t.Errorf("workers %d: Copy = %v, want %v", workers, err, zip.ErrChecksum)
+		}
+	}
+}